@@ -5,17 +5,21 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/cors"
 
+	"github.com/hellodhlyn/luppiter/blob"
 	"github.com/hellodhlyn/luppiter/connection"
+	"github.com/hellodhlyn/luppiter/controller/admin"
+	"github.com/hellodhlyn/luppiter/controller/dev"
 	"github.com/hellodhlyn/luppiter/controller/storage"
 	"github.com/hellodhlyn/luppiter/controller/vulcan"
+	"github.com/hellodhlyn/luppiter/envelope"
+	"github.com/hellodhlyn/luppiter/mailer"
 	"github.com/hellodhlyn/luppiter/repository"
 	"github.com/hellodhlyn/luppiter/service"
 )
@@ -27,26 +31,86 @@ func main() {
 		panic(err)
 	}
 
-	// AWS sessions
-	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("ap-northeast-2")}))
-	s3Client := s3.New(sess)
+	// Storage backend
+	blobBackend, err := blob.NewBackend()
+	if err != nil {
+		panic(err)
+	}
+
+	// Keyring to encrypt secrets at rest
+	keyring, err := envelope.NewKeyringFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Mailer
+	mailClient, err := mailer.NewMailer()
+	if err != nil {
+		panic(err)
+	}
+	mailTemplates := mailer.NewTemplates(getenvOrDefault("LUPPITER_MAIL_TEMPLATE_DIR", "templates/mail"), "en")
 
 	// Repositories
 	accountRepo, _ := repository.NewUserAccountRepository(db)
 	identityRepo, _ := repository.NewUserIdentityRepository(db)
-	tokenRepo, _ := repository.NewAccessTokenRepository(db)
+	tokenRepo, _ := repository.NewAccessTokenRepository(db, keyring)
+	tokenRepo, err = newCachedAccessTokenRepository(tokenRepo)
+	if err != nil {
+		panic(err)
+	}
 	appRepo, _ := repository.NewApplicationRepository(db)
+	secretRepo, _ := repository.NewApplicationSecretRepository(db, keyring)
 	bucketRepo, _ := repository.NewStorageBucketRepository(db)
+	objectRepo, _ := repository.NewStorageObjectRepository(db)
+	uploadRepo, _ := repository.NewStorageUploadRepository(db)
+	orgRepo, _ := repository.NewOrganizationRepository(db)
+	auditRepo, _ := repository.NewAdminAuditLogRepository(db)
+	mailRepo, _ := repository.NewMailMessageRepository(db)
+	linkRepo, _ := repository.NewMagicLinkRepository(db)
+	consentRepo, _ := repository.NewConsentGrantRepository(db)
+	webhookRepo, _ := repository.NewWebhookRepository(db, keyring)
+	webhookDeliveryRepo, _ := repository.NewWebhookDeliveryRepository(db)
+	statRepo, _ := repository.NewApplicationStatRepository(db)
 
 	// Services
-	accountSvc, err := service.NewUserAccountService(accountRepo, identityRepo)
+	statsSvc, _ := service.NewStatsService(statRepo, orgRepo)
+	go statsSvc.RunFlush(time.Minute)
+	webhookSvc, _ := service.NewWebhookService(webhookRepo, webhookDeliveryRepo, consentRepo, orgRepo)
+	go webhookSvc.RunQueue(10 * time.Second)
+	accountSvc, err := service.NewUserAccountService(accountRepo, identityRepo, webhookSvc)
 	if err != nil {
 		panic(err)
 	}
-	tokenSvc, _ := service.NewAccessTokenService(tokenRepo)
-	appSvc, _ := service.NewApplicationService(appRepo)
-	authSvc, _ := service.NewAuthenticationService(tokenRepo)
-	storageSvc, _ := service.NewStorageService(bucketRepo, s3Client)
+	tokenSvc, _ := service.NewAccessTokenService(tokenRepo, secretRepo, consentRepo, statsSvc)
+	appSvc, _ := service.NewApplicationService(appRepo, secretRepo, orgRepo)
+	consentSvc, _ := service.NewConsentService(consentRepo, tokenRepo, appRepo, webhookSvc, os.Getenv("LUPPITER_CONSOLE_APP_ID"), getenvOrDefault("LUPPITER_CONSENT_URL", "https://console.luppiter.dev/consent"))
+	orgSvc, _ := service.NewOrganizationService(orgRepo, identityRepo)
+	adminSvc, _ := service.NewAdminService(identityRepo, tokenRepo, appRepo, bucketRepo, orgRepo, auditRepo, webhookSvc)
+	mailSvc, err := service.NewMailService(mailRepo, mailClient, mailTemplates, getenvOrDefault("LUPPITER_MAIL_FROM", "Luppiter <noreply@luppiter.dev>"))
+	if err != nil {
+		panic(err)
+	}
+	go mailSvc.RunQueue(10 * time.Second)
+	guestRetention, err := time.ParseDuration(getenvOrDefault("LUPPITER_GUEST_RETENTION", "720h"))
+	if err != nil {
+		panic(err)
+	}
+	guestSvc, _ := service.NewGuestService(identityRepo, guestRetention)
+	go guestSvc.RunCleanup(time.Hour)
+	magicLinkSvc, _ := service.NewMagicLinkService(linkRepo, accountRepo, identityRepo, mailSvc, webhookSvc, getenvOrDefault("LUPPITER_MAGIC_LINK_URL", "https://console.luppiter.dev/signin/email"))
+	authSvc, _ := service.NewAuthenticationService(tokenRepo, statsSvc)
+	maxObjectSize, err := strconv.ParseInt(getenvOrDefault("LUPPITER_STORAGE_MAX_OBJECT_SIZE", "104857600"), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	storageSvc, _ := service.NewStorageService(bucketRepo, objectRepo, uploadRepo, orgRepo, blobBackend, maxObjectSize, newURLSigner())
+	go storageSvc.RunPurge(time.Minute)
+	go storageSvc.RunUploadCleanup(time.Hour)
+	go func() {
+		if created := storageSvc.BackfillObjects(); created > 0 {
+			log.Printf("recorded %d storage objects missing from the database", created)
+		}
+	}()
 
 	// Routes
 	router := httprouter.New()
@@ -55,24 +119,145 @@ func main() {
 	})
 
 	// Routes - /vulcan (v1)
-	appCtrl, _ := vulcan.NewApplicationsController(appSvc)
-	authCtrl, _ := vulcan.NewAuthController(accountSvc, appSvc, tokenSvc, authSvc)
+	appCtrl, _ := vulcan.NewApplicationsController(appSvc, statsSvc, authSvc)
+	webhookCtrl, _ := vulcan.NewWebhooksController(appSvc, webhookSvc, authSvc)
+	authCtrl, _ := vulcan.NewAuthController(accountSvc, magicLinkSvc, guestSvc, appSvc, tokenSvc, consentSvc, authSvc)
+	router.GET("/vulcan/applications", appCtrl.List)
+	router.POST("/vulcan/applications", appCtrl.Create)
 	router.GET("/vulcan/applications/:uuid", appCtrl.Get)
+	router.PUT("/vulcan/applications/:uuid", appCtrl.Update)
+	router.DELETE("/vulcan/applications/:uuid", appCtrl.Delete)
+	router.GET("/vulcan/applications/:uuid/secrets", appCtrl.ListSecrets)
+	router.POST("/vulcan/applications/:uuid/secrets", appCtrl.CreateSecret)
+	router.PUT("/vulcan/applications/:uuid/secrets/:kid", appCtrl.UpdateSecret)
+	router.DELETE("/vulcan/applications/:uuid/secrets/:kid", appCtrl.RetireSecret)
+	router.GET("/vulcan/applications/:uuid/stats", appCtrl.GetStats)
+	router.GET("/vulcan/applications/:uuid/webhooks", webhookCtrl.List)
+	router.POST("/vulcan/applications/:uuid/webhooks", webhookCtrl.Create)
+	router.PUT("/vulcan/applications/:uuid/webhooks/:webhook", webhookCtrl.Update)
+	router.DELETE("/vulcan/applications/:uuid/webhooks/:webhook", webhookCtrl.Delete)
+	router.GET("/vulcan/applications/:uuid/webhooks/:webhook/deliveries", webhookCtrl.ListDeliveries)
+	router.POST("/vulcan/applications/:uuid/webhooks/:webhook/deliveries/:delivery/redeliver", webhookCtrl.Redeliver)
 	router.GET("/vulcan/auth/me", authCtrl.GetMe)
 	router.POST("/vulcan/auth/signin/google", authCtrl.AuthByGoogle)
+	router.POST("/vulcan/auth/signin/email", authCtrl.SendMagicLink)
+	router.POST("/vulcan/auth/signin/email/verify", authCtrl.AuthByMagicLink)
+	router.POST("/vulcan/auth/signin/guest", authCtrl.AuthAsGuest)
+	router.POST("/vulcan/auth/link/google", authCtrl.LinkGoogleAccount)
+	router.POST("/vulcan/auth/link/email/verify", authCtrl.LinkByMagicLink)
 	router.POST("/vulcan/auth/activate", authCtrl.ActivateAccessToken)
+	router.POST("/vulcan/auth/refresh", authCtrl.RefreshAccessToken)
+	router.GET("/vulcan/auth/consent/:key", authCtrl.GetConsentRequest)
+	router.POST("/vulcan/auth/consent/:key", authCtrl.Consent)
+	router.GET("/vulcan/auth/authorized-apps", authCtrl.ListAuthorizedApps)
+	router.DELETE("/vulcan/auth/authorized-apps/:uuid", authCtrl.RevokeAuthorizedApp)
+
+	orgCtrl, _ := vulcan.NewOrganizationsController(orgSvc, authSvc)
+	router.GET("/vulcan/organizations", orgCtrl.List)
+	router.POST("/vulcan/organizations", orgCtrl.Create)
+	router.GET("/vulcan/organizations/:uuid/members", orgCtrl.ListMembers)
+	router.PUT("/vulcan/organizations/:uuid/members/:identity", orgCtrl.PutMember)
+	router.DELETE("/vulcan/organizations/:uuid/members/:identity", orgCtrl.DeleteMember)
+
+	bucketCtrl, _ := vulcan.NewBucketsController(storageSvc, authSvc)
+	router.GET("/vulcan/buckets", bucketCtrl.List)
+	router.POST("/vulcan/buckets", bucketCtrl.Create)
+	router.PUT("/vulcan/buckets/:name", bucketCtrl.Update)
+	router.DELETE("/vulcan/buckets/:name", bucketCtrl.Delete)
+	router.POST("/vulcan/buckets/:name/signed-urls", bucketCtrl.SignURL)
 
 	// Routes - /storage
-	storageCtrl, _ := storage.NewStorageController(storageSvc)
+	storageCtrl, _ := storage.NewStorageController(storageSvc, authSvc)
 	router.GET("/storage/:bucket/*key", storageCtrl.GetFile)
+	router.HEAD("/storage/:bucket/*key", storageCtrl.HeadFile)
+	router.PUT("/storage/:bucket/*key", storageCtrl.PutFile)
+	router.POST("/storage/:bucket/*key", storageCtrl.PostFile)
+	router.DELETE("/storage/:bucket/*key", storageCtrl.DeleteFile)
+	router.POST("/storage/:bucket", storageCtrl.DeleteFiles)
+	router.GET("/storage/:bucket", storageCtrl.ListFiles)
+
+	// Routes - /admin
+	adminCtrl, _ := admin.NewAdminController(adminSvc, authSvc)
+	router.GET("/admin/identities", adminCtrl.ListIdentities)
+	router.PUT("/admin/identities/:uuid/status", adminCtrl.SetIdentityStatus)
+	router.POST("/admin/identities/:uuid/revoke-tokens", adminCtrl.RevokeTokens)
+	router.POST("/admin/applications/:uuid/transfer", adminCtrl.TransferApplication)
+	router.GET("/admin/buckets/:name", adminCtrl.GetBucket)
+	router.POST("/admin/buckets/:name/transfer", adminCtrl.TransferBucket)
+	router.GET("/admin/audit-logs", adminCtrl.ListAuditLogs)
+
+	// Routes - /dev
+	if localMailer, ok := mailClient.(*mailer.LocalMailer); ok && os.Getenv("LUPPITER_MAIL_INBOX_ENABLED") == "true" {
+		mailboxCtrl, _ := dev.NewMailboxController(localMailer)
+		router.GET("/dev/mailbox", mailboxCtrl.List)
+		router.GET("/dev/mailbox/:id", mailboxCtrl.Get)
+	}
 
 	// Route configs
-	origins := strings.Split(os.Getenv("LUPPITER_ALLOWED_ORIGINS"), ",")
+	originSvc, _ := service.NewOriginService(appRepo, strings.Split(os.Getenv("LUPPITER_ALLOWED_ORIGINS"), ","))
+	originListener, err := connection.NewListener(repository.ChannelApplicationsChanged)
+	if err != nil {
+		panic(err)
+	}
+	go originSvc.Watch(originListener)
+
 	handler := cors.New(cors.Options{
-		AllowedOrigins: origins,
-		AllowedHeaders: []string{"*"},
+		AllowOriginFunc: originSvc.IsAllowedOrigin,
+		AllowedMethods:  []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete},
+		AllowedHeaders:  []string{"*"},
+		// Headers of storage files, which browsers do not expose to scripts by default
+		ExposedHeaders: []string{"ETag", "Last-Modified", "Content-Range", "Accept-Ranges", "Content-Disposition"},
 	}).Handler(router)
 
 	fmt.Println("Start and listening 0.0.0.0:8080")
 	log.Fatal(http.ListenAndServe(":8080", handler))
 }
+
+func newCachedAccessTokenRepository(repo repository.AccessTokenRepository) (repository.AccessTokenRepository, error) {
+	size, err := strconv.Atoi(getenvOrDefault("LUPPITER_TOKEN_CACHE_SIZE", "10000"))
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := time.ParseDuration(getenvOrDefault("LUPPITER_TOKEN_CACHE_TTL", "1m"))
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return repo, nil
+	}
+
+	listener, err := connection.NewListener(repository.CacheInvalidationChannels...)
+	if err != nil {
+		return nil, err
+	}
+	return repository.NewCachedAccessTokenRepository(repo, listener, size, ttl)
+}
+
+// newURLSigner creates a signer from `LUPPITER_STORAGE_SIGNING_KEYS`, formatted same as `LUPPITER_MASTER_KEYS`. Signed
+// URLs are not available if not set.
+func newURLSigner() *service.URLSigner {
+	keys, current, err := envelope.ParseKeys(os.Getenv("LUPPITER_STORAGE_SIGNING_KEYS"))
+	if err != nil {
+		panic(fmt.Errorf("invalid LUPPITER_STORAGE_SIGNING_KEYS: %w", err))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	// The last version in the list is used if the version is empty, as in .envrc.example.
+	if version := os.Getenv("LUPPITER_STORAGE_SIGNING_KEY_VERSION"); version != "" {
+		current = version
+	}
+
+	signer, err := service.NewURLSigner(keys, current)
+	if err != nil {
+		panic(err)
+	}
+	return signer
+}
+
+func getenvOrDefault(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
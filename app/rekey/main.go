@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/hellodhlyn/luppiter/connection"
+	"github.com/hellodhlyn/luppiter/envelope"
+)
+
+const batchSize = 100
+
+// Tables which have encrypted `secret_key` columns.
+var tables = []string{"access_tokens", "application_secrets"}
+
+type encryptedRow struct {
+	id        int64
+	secretKey string
+}
+
+// Re-encrypts every secret key which is not encrypted by the current master key, such as after adding a new master
+// key version. Old master keys can be removed from LUPPITER_MASTER_KEYS after this finishes.
+func main() {
+	db, err := connection.NewDatabaseConnection()
+	if err != nil {
+		panic(err)
+	}
+	keyring, err := envelope.NewKeyringFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, table := range tables {
+		count, err := rekey(db.DB(), keyring, table)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s: re-encrypted %d rows with master key %s\n", table, count, keyring.CurrentVersion())
+	}
+}
+
+func rekey(db *sql.DB, keyring *envelope.Keyring, table string) (int, error) {
+	count := 0
+	lastID := int64(0)
+	for {
+		batch, err := findBatch(db, table, lastID)
+		if err != nil {
+			return count, err
+		}
+		if len(batch) == 0 {
+			return count, nil
+		}
+
+		for _, row := range batch {
+			lastID = row.id
+			if !keyring.NeedsRewrap(row.secretKey) {
+				continue
+			}
+
+			plaintext, err := keyring.Decrypt(row.secretKey)
+			if err != nil {
+				return count, fmt.Errorf("%s %d: %w", table, row.id, err)
+			}
+			encrypted, err := keyring.Encrypt(plaintext)
+			if err != nil {
+				return count, err
+			}
+
+			// Skip the row if it is changed meanwhile, since it is encrypted by the current master key then.
+			query := fmt.Sprintf("update %s set secret_key = $1 where id = $2 and secret_key = $3", table)
+			if _, err := db.Exec(query, encrypted, row.id, row.secretKey); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+}
+
+func findBatch(db *sql.DB, table string, lastID int64) ([]encryptedRow, error) {
+	rows, err := db.Query(fmt.Sprintf("select id, secret_key from %s where id > $1 order by id limit %d", table, batchSize), lastID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []encryptedRow
+	for rows.Next() {
+		var row encryptedRow
+		if err := rows.Scan(&row.id, &row.secretKey); err != nil {
+			return nil, err
+		}
+		batch = append(batch, row)
+	}
+	return batch, rows.Err()
+}
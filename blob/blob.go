@@ -0,0 +1,93 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	driverS3     = "s3"
+	driverLocal  = "local"
+	driverMemory = "memory"
+)
+
+var (
+	ErrNotFound    = errors.New("no such blob")
+	ErrInvalidKey  = errors.New("invalid blob key")
+	ErrInvalidPart = errors.New("invalid part")
+)
+
+// Info is the metadata of a blob. ETag may be empty if the backend does not track it.
+type Info struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Backend stores blobs by keys, which are paths separated by slashes.
+type Backend interface {
+	// Get returns the content of the blob, or ErrNotFound.
+	Get(key string) (io.ReadCloser, *Info, error)
+	// GetRange returns the content of the blob from the offset, up to the length.
+	GetRange(key string, offset, length int64) (io.ReadCloser, error)
+	// Put writes the blob, overwriting the existing one.
+	Put(key string, body io.Reader, contentType string) error
+	// Delete deletes blobs of the keys, and returns errors of keys failed to delete. Missing keys are not failures.
+	Delete(keys []string) (map[string]error, error)
+	// List returns blobs whose keys start with the prefix and come after `after`, in the order of keys.
+	List(prefix, after string, limit int) ([]*Info, error)
+	// Head returns whether the blob exists.
+	Head(key string) (bool, error)
+	// Stat returns the metadata of the blob, or ErrNotFound.
+	Stat(key string) (*Info, error)
+}
+
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	PartNumber int64
+	ETag       string
+}
+
+// DirectUploader is implemented by backends which clients can upload blobs to directly, with presigned URLs.
+type DirectUploader interface {
+	PresignPut(key, contentType string, size int64, ttl time.Duration) (string, error)
+	CreateMultipartUpload(key, contentType string) (string, error)
+	PresignUploadPart(key, uploadID string, partNumber int64, ttl time.Duration) (string, error)
+	// ListParts returns ETags of uploaded parts by their part numbers.
+	ListParts(key, uploadID string) (map[int64]string, error)
+	CompleteMultipartUpload(key, uploadID string, parts []*Part) error
+	// AbortMultipartUpload aborts the upload. Uploads which do not exist are regarded as aborted.
+	AbortMultipartUpload(key, uploadID string) error
+}
+
+func getenvOrDefault(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// NewBackend creates a backend for the driver configured by `LUPPITER_STORAGE_DRIVER`. The `local` driver stores blobs
+// in a directory, and the `memory` driver keeps them only in memory, which are useful for development and tests.
+func NewBackend() (Backend, error) {
+	switch driver := getenvOrDefault("LUPPITER_STORAGE_DRIVER", driverS3); driver {
+	case driverS3:
+		return NewS3Backend(
+			os.Getenv("LUPPITER_S3_ENDPOINT"),
+			getenvOrDefault("LUPPITER_S3_REGION", "ap-northeast-2"),
+			getenvOrDefault("LUPPITER_S3_BUCKET", "luppiter.lynlab.co.kr"),
+			getenvOrDefault("LUPPITER_S3_FORCE_PATH_STYLE", "false") == "true",
+		)
+	case driverLocal:
+		return NewLocalBackend(getenvOrDefault("LUPPITER_STORAGE_LOCAL_DIR", "tmp/storage"))
+	case driverMemory:
+		return NewMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", driver)
+	}
+}
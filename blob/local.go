@@ -0,0 +1,206 @@
+package blob
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const localTempPrefix = ".luppiter-tmp-"
+
+// LocalBackend stores blobs as files in a directory. Content types are not stored, but guessed from keys.
+type LocalBackend struct {
+	dir string
+}
+
+func NewLocalBackend(dir string) (*LocalBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalBackend{dir: dir}, nil
+}
+
+func (b *LocalBackend) Get(key string) (io.ReadCloser, *Info, error) {
+	filename, err := b.filename(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, translateLocal(err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+	return file, localInfo(key, stat), nil
+}
+
+func (b *LocalBackend) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	filename, err := b.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, translateLocal(err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &limitedFile{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+// Put writes the blob into a temporary file first, so that readers do not see a partially written file.
+func (b *LocalBackend) Put(key string, body io.Reader, _ string) error {
+	filename, err := b.filename(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(filename), localTempPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := io.Copy(temp, body); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filename)
+}
+
+func (b *LocalBackend) Delete(keys []string) (map[string]error, error) {
+	failed := map[string]error{}
+	for _, key := range keys {
+		filename, err := b.filename(key)
+		if err == nil {
+			err = os.Remove(filename)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			failed[key] = err
+			continue
+		}
+		b.removeEmptyDirs(filepath.Dir(filename))
+	}
+	return failed, nil
+}
+
+func (b *LocalBackend) List(prefix, after string, limit int) ([]*Info, error) {
+	// Walk only the directory containing the prefix.
+	root := b.dir
+	if dir := path.Dir(prefix + "x"); dir != "." {
+		root = filepath.Join(b.dir, filepath.FromSlash(dir))
+	}
+	if rel, err := filepath.Rel(b.dir, root); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, ErrInvalidKey
+	}
+
+	var infos []*Info
+	err := filepath.Walk(root, func(filename string, stat os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if stat.IsDir() || strings.HasPrefix(stat.Name(), localTempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.dir, filename)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) && key > after {
+			infos = append(infos, localInfo(key, stat))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	if len(infos) > limit {
+		infos = infos[:limit]
+	}
+	return infos, nil
+}
+
+func (b *LocalBackend) Head(key string) (bool, error) {
+	_, err := b.Stat(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *LocalBackend) Stat(key string) (*Info, error) {
+	filename, err := b.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return nil, translateLocal(err)
+	}
+	if stat.IsDir() {
+		return nil, ErrNotFound
+	}
+	return localInfo(key, stat), nil
+}
+
+// filename returns the path of the blob, and rejects keys which may escape the directory.
+func (b *LocalBackend) filename(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") || path.Clean(key) != key ||
+		strings.HasPrefix(key, "../") || path.Base(key) == ".." {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(b.dir, filepath.FromSlash(key)), nil
+}
+
+// removeEmptyDirs removes the directory and its parents while they are empty, up to the root directory.
+func (b *LocalBackend) removeEmptyDirs(dir string) {
+	for dir != b.dir && strings.HasPrefix(dir, b.dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func localInfo(key string, stat os.FileInfo) *Info {
+	return &Info{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: stat.ModTime(),
+	}
+}
+
+func translateLocal(err error) error {
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
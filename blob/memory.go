@@ -0,0 +1,129 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps blobs in memory, which are lost on restarts.
+type MemoryBackend struct {
+	mu    sync.RWMutex
+	blobs map[string]*memoryBlob
+}
+
+type memoryBlob struct {
+	info Info
+	data []byte
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{blobs: map[string]*memoryBlob{}}
+}
+
+func (b *MemoryBackend) Get(key string) (io.ReadCloser, *Info, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	blob, ok := b.blobs[key]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	info := blob.info
+	return ioutil.NopCloser(bytes.NewReader(blob.data)), &info, nil
+}
+
+func (b *MemoryBackend) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	blob, ok := b.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	end := offset + length
+	if offset > int64(len(blob.data)) {
+		offset = int64(len(blob.data))
+	}
+	if end > int64(len(blob.data)) {
+		end = int64(len(blob.data))
+	}
+	return ioutil.NopCloser(bytes.NewReader(blob.data[offset:end])), nil
+}
+
+func (b *MemoryBackend) Put(key string, body io.Reader, contentType string) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(data)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blobs[key] = &memoryBlob{
+		info: Info{
+			Key:          key,
+			Size:         int64(len(data)),
+			ContentType:  contentType,
+			ETag:         hex.EncodeToString(sum[:]),
+			LastModified: time.Now(),
+		},
+		data: data,
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Delete(keys []string) (map[string]error, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, key := range keys {
+		delete(b.blobs, key)
+	}
+	return map[string]error{}, nil
+}
+
+func (b *MemoryBackend) List(prefix, after string, limit int) ([]*Info, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var infos []*Info
+	for key, blob := range b.blobs {
+		if strings.HasPrefix(key, prefix) && key > after {
+			info := blob.info
+			infos = append(infos, &info)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	if len(infos) > limit {
+		infos = infos[:limit]
+	}
+	return infos, nil
+}
+
+func (b *MemoryBackend) Head(key string) (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	_, ok := b.blobs[key]
+	return ok, nil
+}
+
+func (b *MemoryBackend) Stat(key string) (*Info, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	blob, ok := b.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	info := blob.info
+	return &info, nil
+}
@@ -0,0 +1,235 @@
+package blob
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Backend stores blobs in an S3 bucket. Set the endpoint for S3 compatible services such as MinIO, which usually
+// need path style requests too.
+type S3Backend struct {
+	s3     *s3.S3
+	bucket string
+}
+
+func NewS3Backend(endpoint, region, bucket string, forcePathStyle bool) (*S3Backend, error) {
+	config := &aws.Config{Region: aws.String(region), S3ForcePathStyle: aws.Bool(forcePathStyle)}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Backend{s3: s3.New(sess), bucket: bucket}, nil
+}
+
+func (b *S3Backend) Get(key string) (io.ReadCloser, *Info, error) {
+	output, err := b.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, b.translate(err)
+	}
+
+	info := &Info{
+		Key:          key,
+		Size:         aws.Int64Value(output.ContentLength),
+		ContentType:  aws.StringValue(output.ContentType),
+		ETag:         strings.Trim(aws.StringValue(output.ETag), `"`),
+		LastModified: aws.TimeValue(output.LastModified),
+	}
+	return output.Body, info, nil
+}
+
+func (b *S3Backend) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	output, err := b.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, b.translate(err)
+	}
+	return output.Body, nil
+}
+
+func (b *S3Backend) Put(key string, body io.Reader, contentType string) error {
+	_, err := s3manager.NewUploaderWithClient(b.s3).Upload(&s3manager.UploadInput{
+		Bucket:      aws.String(b.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+func (b *S3Backend) Delete(keys []string) (map[string]error, error) {
+	identifiers := make([]*s3.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		identifiers[i] = &s3.ObjectIdentifier{Key: aws.String(key)}
+	}
+	output, err := b.s3.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: aws.String(b.bucket),
+		Delete: &s3.Delete{Objects: identifiers, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	failed := map[string]error{}
+	for _, e := range output.Errors {
+		failed[aws.StringValue(e.Key)] = awserr.New(aws.StringValue(e.Code), aws.StringValue(e.Message), nil)
+	}
+	return failed, nil
+}
+
+func (b *S3Backend) List(prefix, after string, limit int) ([]*Info, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(b.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(int64(limit)),
+	}
+	if after != "" {
+		input.StartAfter = aws.String(after)
+	}
+	output, err := b.s3.ListObjectsV2(input)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*Info, len(output.Contents))
+	for i, object := range output.Contents {
+		infos[i] = &Info{
+			Key:          aws.StringValue(object.Key),
+			Size:         aws.Int64Value(object.Size),
+			ETag:         strings.Trim(aws.StringValue(object.ETag), `"`),
+			LastModified: aws.TimeValue(object.LastModified),
+		}
+	}
+	return infos, nil
+}
+
+func (b *S3Backend) Head(key string) (bool, error) {
+	_, err := b.Stat(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *S3Backend) Stat(key string) (*Info, error) {
+	output, err := b.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, b.translate(err)
+	}
+
+	return &Info{
+		Key:          key,
+		Size:         aws.Int64Value(output.ContentLength),
+		ContentType:  aws.StringValue(output.ContentType),
+		ETag:         strings.Trim(aws.StringValue(output.ETag), `"`),
+		LastModified: aws.TimeValue(output.LastModified),
+	}, nil
+}
+
+func (b *S3Backend) PresignPut(key, contentType string, size int64, ttl time.Duration) (string, error) {
+	// The size and the content type are signed, so that the blob can not be uploaded with others.
+	req, _ := b.s3.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:        aws.String(b.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	})
+	return req.Presign(ttl)
+}
+
+func (b *S3Backend) CreateMultipartUpload(key, contentType string) (string, error) {
+	output, err := b.s3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(b.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.UploadId), nil
+}
+
+func (b *S3Backend) PresignUploadPart(key, uploadID string, partNumber int64, ttl time.Duration) (string, error) {
+	req, _ := b.s3.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:     aws.String(b.bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(partNumber),
+	})
+	return req.Presign(ttl)
+}
+
+func (b *S3Backend) ListParts(key, uploadID string) (map[int64]string, error) {
+	uploaded := map[int64]string{}
+	err := b.s3.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(b.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, func(output *s3.ListPartsOutput, _ bool) bool {
+		for _, part := range output.Parts {
+			uploaded[aws.Int64Value(part.PartNumber)] = strings.Trim(aws.StringValue(part.ETag), `"`)
+		}
+		return true
+	})
+	return uploaded, err
+}
+
+func (b *S3Backend) CompleteMultipartUpload(key, uploadID string, parts []*Part) error {
+	completed := make([]*s3.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = &s3.CompletedPart{PartNumber: aws.Int64(part.PartNumber), ETag: aws.String(`"` + part.ETag + `"`)}
+	}
+	_, err := b.s3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == "EntityTooSmall" || aerr.Code() == "InvalidPart") {
+		return fmt.Errorf("%w: %s", ErrInvalidPart, aerr.Message())
+	}
+	return err
+}
+
+func (b *S3Backend) AbortMultipartUpload(key, uploadID string) error {
+	_, err := b.s3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+		return nil
+	}
+	return err
+}
+
+// translate converts errors of missing keys into ErrNotFound. HEAD requests respond 404 without the error code.
+func (b *S3Backend) translate(err error) error {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return ErrNotFound
+	}
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
@@ -3,9 +3,11 @@ package connection
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/lib/pq"
 )
 
 func getenvOrDefault(key, defaultValue string) string {
@@ -15,12 +17,28 @@ func getenvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
-func NewDatabaseConnection() (*gorm.DB, error) {
+func dataSourceName() string {
 	dbUsername := getenvOrDefault("DB_USERNAME", "postgres")
 	dbPassword := getenvOrDefault("DB_PASSWORD", "rootpass")
 	dbHost := getenvOrDefault("DB_HOST", "127.0.0.1")
 	dbPort := getenvOrDefault("DB_PORT", "5432")
 	dbName := getenvOrDefault("DB_NAME", "luppiter")
 
-	return gorm.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbHost, dbPort, dbUsername, dbPassword, dbName))
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbHost, dbPort, dbUsername, dbPassword, dbName)
+}
+
+func NewDatabaseConnection() (*gorm.DB, error) {
+	return gorm.Open("postgres", dataSourceName())
+}
+
+// NewListener opens a dedicated connection which receives notifications sent by `pg_notify` on the given channels.
+func NewListener(channels ...string) (*pq.Listener, error) {
+	listener := pq.NewListener(dataSourceName(), time.Second, time.Minute, nil)
+	for _, channel := range channels {
+		if err := listener.Listen(channel); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
 }
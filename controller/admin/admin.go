@@ -0,0 +1,264 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/service"
+)
+
+const defaultPageSize = 50
+
+type AdminController interface {
+	ListIdentities(http.ResponseWriter, *http.Request, httprouter.Params)
+	SetIdentityStatus(http.ResponseWriter, *http.Request, httprouter.Params)
+	RevokeTokens(http.ResponseWriter, *http.Request, httprouter.Params)
+	TransferApplication(http.ResponseWriter, *http.Request, httprouter.Params)
+	GetBucket(http.ResponseWriter, *http.Request, httprouter.Params)
+	TransferBucket(http.ResponseWriter, *http.Request, httprouter.Params)
+	ListAuditLogs(http.ResponseWriter, *http.Request, httprouter.Params)
+}
+
+type AdminControllerImpl struct {
+	svc     service.AdminService
+	authSvc service.AuthenticationService
+}
+
+func NewAdminController(adminSvc service.AdminService, authSvc service.AuthenticationService) (AdminController, error) {
+	return &AdminControllerImpl{adminSvc, authSvc}, nil
+}
+
+type IdentityBody struct {
+	UUID      string     `json:"uuid"`
+	Username  string     `json:"username"`
+	Email     string     `json:"email"`
+	IsAdmin   bool       `json:"isAdmin"`
+	Status    string     `json:"status"`
+	CreatedAt *time.Time `json:"createdAt"`
+
+	SuspensionReason string     `json:"suspensionReason,omitempty"`
+	SuspendedUntil   *time.Time `json:"suspendedUntil,omitempty"`
+}
+
+type ApplicationBody struct {
+	UUID           string `json:"uuid"`
+	Name           string `json:"name"`
+	OwnerID        int64  `json:"ownerId"`
+	OrganizationID *int64 `json:"organizationId"`
+}
+
+type BucketBody struct {
+	Name           string     `json:"name"`
+	OwnerID        int64      `json:"ownerId"`
+	OrganizationID *int64     `json:"organizationId"`
+	IsPublic       bool       `json:"isPublic"`
+	CreatedAt      *time.Time `json:"createdAt"`
+	UpdatedAt      *time.Time `json:"updatedAt"`
+}
+
+type AuditLogBody struct {
+	Actor     string     `json:"actor"`
+	Action    string     `json:"action"`
+	Target    string     `json:"target"`
+	Detail    string     `json:"detail"`
+	CreatedAt *time.Time `json:"createdAt"`
+}
+
+type SetIdentityStatusReqBody struct {
+	Status string     `json:"status"`
+	Reason string     `json:"reason"`
+	Until  *time.Time `json:"until"`
+}
+
+type TransferReqBody struct {
+	OwnerUUID        string `json:"ownerUuid"`
+	OrganizationUUID string `json:"organizationUuid"`
+}
+
+// GET /admin/identities?q=&offset=&limit=
+func (ctrl *AdminControllerImpl) ListIdentities(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	offset, limit := pagination(r)
+	identities, err := ctrl.svc.SearchIdentities(user, r.URL.Query().Get("q"), offset, limit)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*IdentityBody, 0)
+	for _, identity := range identities {
+		resBody = append(resBody, newIdentityBody(identity))
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// PUT /admin/identities/:uuid/status
+func (ctrl *AdminControllerImpl) SetIdentityStatus(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody SetIdentityStatusReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	identity, err := ctrl.svc.SetIdentityStatus(user, p.ByName("uuid"), reqBody.Status, reqBody.Reason, reqBody.Until)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newIdentityBody(identity))
+}
+
+// POST /admin/identities/:uuid/revoke-tokens
+func (ctrl *AdminControllerImpl) RevokeTokens(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	err = ctrl.svc.RevokeAccessTokens(user, p.ByName("uuid"))
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /admin/applications/:uuid/transfer
+func (ctrl *AdminControllerImpl) TransferApplication(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody TransferReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app, err := ctrl.svc.TransferApplication(user, p.ByName("uuid"), reqBody.OwnerUUID, reqBody.OrganizationUUID)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, &ApplicationBody{UUID: app.UUID, Name: app.Name, OwnerID: int64(app.OwnerID), OrganizationID: app.OrganizationID})
+}
+
+// GET /admin/buckets/:name
+func (ctrl *AdminControllerImpl) GetBucket(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	bucket, err := ctrl.svc.GetBucket(user, p.ByName("name"))
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newBucketBody(bucket))
+}
+
+// POST /admin/buckets/:name/transfer
+func (ctrl *AdminControllerImpl) TransferBucket(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody TransferReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucket, err := ctrl.svc.TransferBucket(user, p.ByName("name"), reqBody.OwnerUUID, reqBody.OrganizationUUID)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newBucketBody(bucket))
+}
+
+// GET /admin/audit-logs?offset=&limit=
+func (ctrl *AdminControllerImpl) ListAuditLogs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	offset, limit := pagination(r)
+	logs, err := ctrl.svc.ListAuditLogs(user, offset, limit)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*AuditLogBody, 0)
+	for _, log := range logs {
+		resBody = append(resBody, &AuditLogBody{Actor: log.Actor.UUID, Action: log.Action, Target: log.Target, Detail: log.Detail, CreatedAt: log.CreatedAt})
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+func pagination(r *http.Request) (offset, limit int) {
+	offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > defaultPageSize {
+		limit = defaultPageSize
+	}
+	return
+}
+
+func newIdentityBody(identity *model.UserIdentity) *IdentityBody {
+	return &IdentityBody{
+		UUID:      identity.UUID,
+		Username:  identity.Username,
+		Email:     identity.Email,
+		IsAdmin:   identity.IsAdmin,
+		Status:    identity.EffectiveStatus(),
+		CreatedAt: identity.CreatedAt,
+
+		SuspensionReason: identity.SuspensionReason,
+		SuspendedUntil:   identity.SuspendedUntil,
+	}
+}
+
+func newBucketBody(bucket *model.StorageBucket) *BucketBody {
+	return &BucketBody{
+		Name:           bucket.Name,
+		OwnerID:        bucket.OwnerID,
+		OrganizationID: bucket.OrganizationID,
+		IsPublic:       bucket.IsPublic,
+		CreatedAt:      bucket.CreatedAt,
+		UpdatedAt:      bucket.UpdatedAt,
+	}
+}
@@ -0,0 +1,63 @@
+package dev
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/mailer"
+)
+
+// MailboxController serves messages captured by the local mailer, for development and tests only.
+type MailboxController interface {
+	List(http.ResponseWriter, *http.Request, httprouter.Params)
+	Get(http.ResponseWriter, *http.Request, httprouter.Params)
+}
+
+type MailboxControllerImpl struct {
+	mailer *mailer.LocalMailer
+}
+
+func NewMailboxController(m *mailer.LocalMailer) (MailboxController, error) {
+	return &MailboxControllerImpl{m}, nil
+}
+
+type MailBody struct {
+	ID      string    `json:"id"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Date    time.Time `json:"date"`
+}
+
+// GET /dev/mailbox
+func (ctrl *MailboxControllerImpl) List(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	messages, err := ctrl.mailer.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resBody := make([]*MailBody, 0)
+	for _, msg := range messages {
+		resBody = append(resBody, &MailBody{ID: msg.ID, To: msg.To, Subject: msg.Subject, Date: msg.Date})
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// GET /dev/mailbox/:id
+func (ctrl *MailboxControllerImpl) Get(w http.ResponseWriter, _ *http.Request, p httprouter.Params) {
+	raw, err := ctrl.mailer.Read(p.ByName("id"))
+	if os.IsNotExist(err) {
+		http.Error(w, "no such message", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "message/rfc822")
+	_, _ = w.Write(raw)
+}
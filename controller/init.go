@@ -2,9 +2,12 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/service"
 )
 
 func Authorized(w http.ResponseWriter, r *http.Request, fn func(*model.UserIdentity)) {
@@ -15,3 +18,47 @@ func JsonResponse(w http.ResponseWriter, res interface{}) {
 	w.Header().Set("Content-Type", "application/json; encode=utf-8")
 	_ = json.NewEncoder(w).Encode(res)
 }
+
+type ErrorBody struct {
+	Code    string     `json:"code"`
+	Message string     `json:"message"`
+	Reason  string     `json:"reason,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+// ErrorResponse writes an error returned by services with the matching status code.
+func ErrorResponse(w http.ResponseWriter, err error) {
+	var statusErr *service.IdentityStatusError
+	switch {
+	case errors.As(err, &statusErr):
+		identityStatusErrorResponse(w, statusErr)
+	case errors.Is(err, service.ErrInvalidArgument):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrPermissionDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// AuthErrorResponse writes an error returned by `AuthenticationService.Authenticate`.
+func AuthErrorResponse(w http.ResponseWriter, err error) {
+	var statusErr *service.IdentityStatusError
+	if errors.As(err, &statusErr) {
+		identityStatusErrorResponse(w, statusErr)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+func identityStatusErrorResponse(w http.ResponseWriter, err *service.IdentityStatusError) {
+	w.Header().Set("Content-Type", "application/json; encode=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(&ErrorBody{Code: err.Code(), Message: err.Error(), Reason: err.Reason, Until: err.Until})
+}
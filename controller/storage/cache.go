@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/service"
+)
+
+// writeCacheHeaders writes headers to validate the cached file, which are responded with 304 Not Modified too.
+func writeCacheHeaders(w http.ResponseWriter, file *service.StorageFile) {
+	if file.ETag != "" {
+		w.Header().Set("ETag", `"`+file.ETag+`"`)
+	}
+	if !file.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", file.LastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", file.CacheControl)
+}
+
+// isNotModified checks conditional headers as RFC 7232. If-Modified-Since is ignored if If-None-Match is given.
+func isNotModified(r *http.Request, file *service.StorageFile) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return file.ETag != "" && etagMatches(inm, file.ETag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !file.LastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !file.LastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// etagMatches checks whether the header, which is a list of entity tags or `*`, matches the ETag by weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.Trim(strings.TrimPrefix(candidate, "W/"), `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/service"
+)
+
+// Requests with more ranges are responded with the whole file, as they are cheaper to serve at once.
+const maxRanges = 16
+
+var errUnsatisfiableRange = errors.New("unsatisfiable range")
+
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// serveRanges responds the ranges of the file as RFC 7233, reading each range from the backend. It returns false if
+// the Range header should be ignored, to respond the whole file instead.
+func serveRanges(w http.ResponseWriter, r *http.Request, file *service.StorageFile) bool {
+	header := r.Header.Get("Range")
+	if header == "" || !ifRangeMatches(r, file) {
+		return false
+	}
+
+	ranges, err := parseRange(header, file.Size)
+	if err == errUnsatisfiableRange {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+	if ranges == nil || len(ranges) > maxRanges || sumRanges(ranges) > file.Size {
+		return false
+	}
+
+	if len(ranges) == 1 {
+		body, err := file.OpenRange(ranges[0].start, ranges[0].length)
+		if err != nil {
+			controller.ErrorResponse(w, err)
+			return true
+		}
+		defer body.Close()
+
+		w.Header().Set("Content-Type", file.ContentType)
+		w.Header().Set("Content-Range", ranges[0].contentRange(file.Size))
+		w.Header().Set("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = io.Copy(w, body)
+		return true
+	}
+
+	// Open the first range before writing the status, so that missing files are responded with errors.
+	body, err := file.OpenRange(ranges[0].start, ranges[0].length)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return true
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+	for i, rng := range ranges {
+		if i > 0 {
+			if body, err = file.OpenRange(rng.start, rng.length); err != nil {
+				// The status is already written, so just cut the response off.
+				return true
+			}
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {file.ContentType},
+			"Content-Range": {rng.contentRange(file.Size)},
+		})
+		if err == nil {
+			_, err = io.Copy(part, body)
+		}
+		_ = body.Close()
+		if err != nil {
+			return true
+		}
+	}
+	_ = mw.Close()
+	return true
+}
+
+// parseRange parses the Range header for the file of the size. It returns nil if the header is malformed, which should
+// be ignored, and errUnsatisfiableRange if no range overlaps the file.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.Index(spec, "-")
+		if i < 0 {
+			return nil, nil
+		}
+		first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+		if first == "" {
+			// A suffix range, for the last bytes of the file.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n > size {
+				n = size
+			}
+			if n == 0 {
+				continue
+			}
+			ranges = append(ranges, byteRange{start: size - n, length: n})
+			continue
+		}
+
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, nil
+		}
+		end := size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return nil, nil
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, byteRange{start: start, length: end - start + 1})
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+func sumRanges(ranges []byteRange) int64 {
+	var sum int64
+	for _, r := range ranges {
+		sum += r.length
+	}
+	return sum
+}
+
+// ifRangeMatches checks the If-Range header, which is an entity tag compared strongly, or a date compared exactly.
+func ifRangeMatches(r *http.Request, file *service.StorageFile) bool {
+	header := r.Header.Get("If-Range")
+	if header == "" {
+		return true
+	}
+	if strings.HasPrefix(header, `"`) {
+		return file.ETag != "" && header == `"`+file.ETag+`"`
+	}
+	if strings.HasPrefix(header, "W/") {
+		return false
+	}
+	t, err := http.ParseTime(header)
+	return err == nil && !file.LastModified.IsZero() && file.LastModified.Truncate(time.Second).Equal(t)
+}
@@ -1,49 +1,346 @@
 package storage
 
 import (
+	"encoding/json"
 	"errors"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/model"
 	"github.com/hellodhlyn/luppiter/service"
 )
 
 type StorageController interface {
 	GetFile(http.ResponseWriter, *http.Request, httprouter.Params)
+	HeadFile(http.ResponseWriter, *http.Request, httprouter.Params)
+	PutFile(http.ResponseWriter, *http.Request, httprouter.Params)
+	PostFile(http.ResponseWriter, *http.Request, httprouter.Params)
+	DeleteFile(http.ResponseWriter, *http.Request, httprouter.Params)
+	DeleteFiles(http.ResponseWriter, *http.Request, httprouter.Params)
+	ListFiles(http.ResponseWriter, *http.Request, httprouter.Params)
 }
 
 type StorageControllerImpl struct {
 	storageSvc service.StorageService
+	authSvc    service.AuthenticationService
 }
 
-func NewStorageController(storageSvc service.StorageService) (StorageController, error) {
-	return &StorageControllerImpl{storageSvc: storageSvc}, nil
+func NewStorageController(storageSvc service.StorageService, authSvc service.AuthenticationService) (StorageController, error) {
+	return &StorageControllerImpl{storageSvc: storageSvc, authSvc: authSvc}, nil
 }
 
 var ErrNoSuchItem = errors.New("no such item")
 
+type DeleteFilesReqBody struct {
+	Keys   []string `json:"keys"`
+	Prefix *string  `json:"prefix"`
+}
+
+type DeleteResultBody struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type DeleteFilesResBody struct {
+	Results   []*DeleteResultBody `json:"results"`
+	Truncated bool                `json:"truncated"`
+}
+
+type ListFilesResBody struct {
+	Objects    []*ObjectBody `json:"objects"`
+	Prefixes   []string      `json:"prefixes"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+type ObjectBody struct {
+	Key          string     `json:"key"`
+	ContentType  string     `json:"contentType"`
+	Size         int64      `json:"size"`
+	ETag         string     `json:"etag"`
+	LastModified *time.Time `json:"lastModified"`
+}
+
 // GET /storage/:bucket/:key(*)
-func (ctrl *StorageControllerImpl) GetFile(w http.ResponseWriter, _ *http.Request, p httprouter.Params) {
-	file, err := ctrl.storageSvc.ReadFile(p.ByName("bucket"), strings.TrimPrefix(p.ByName("key"), "/"))
+//
+// Authorization is optional, and required only for private buckets. A signed URL can be used in place of it.
+func (ctrl *StorageControllerImpl) GetFile(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	file, ok := ctrl.findFile(w, r, p)
+	if !ok {
+		return
+	}
+
+	writeCacheHeaders(w, file)
+	if isNotModified(r, file) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	if serveRanges(w, r, file) {
+		return
+	}
+
+	body, err := file.Open()
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
-			http.Error(w, ErrNoSuchItem.Error(), http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		controller.ErrorResponse(w, err)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	_, _ = io.Copy(w, body)
+}
+
+// HEAD /storage/:bucket/:key(*)
+//
+// Same as GetFile, but responds only the headers without reading the content.
+func (ctrl *StorageControllerImpl) HeadFile(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	file, ok := ctrl.findFile(w, r, p)
+	if !ok {
+		return
+	}
+
+	writeCacheHeaders(w, file)
+	if isNotModified(r, file) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// PUT /storage/:bucket/:key(*)
+func (ctrl *StorageControllerImpl) PutFile(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+	if r.ContentLength > ctrl.storageSvc.MaxObjectSize() {
+		http.Error(w, "too large object", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	object, err := ctrl.storageSvc.WriteFile(user, p.ByName("bucket"), objectKey(p), r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newObjectBody(object))
+}
+
+// POST /storage/:bucket/:key(*)
+//
+// Uploads the `file` field of a multipart form, for HTML forms. With `uploads` or `uploadId` query, it creates or
+// completes a direct upload instead.
+func (ctrl *StorageControllerImpl) PostFile(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	if _, ok := query["uploads"]; ok {
+		ctrl.createUpload(w, r, p, user)
+		return
+	} else if query.Get("uploadId") != "" {
+		ctrl.completeUpload(w, r, p, user)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Stream the file part without buffering the whole form.
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			http.Error(w, "no file field", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		object, err := ctrl.storageSvc.WriteFile(user, p.ByName("bucket"), objectKey(p), part.Header.Get("Content-Type"), part)
+		if err != nil {
+			controller.ErrorResponse(w, err)
+			return
+		}
+		controller.JsonResponse(w, newObjectBody(object))
+		return
+	}
+}
+
+// DELETE /storage/:bucket/:key(*)
+//
+// With `uploadId` query, it aborts the direct upload instead.
+func (ctrl *StorageControllerImpl) DeleteFile(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+	if r.URL.Query().Get("uploadId") != "" {
+		ctrl.abortUpload(w, r, p, user)
+		return
+	}
+
+	results, err := ctrl.storageSvc.DeleteFiles(user, p.ByName("bucket"), []string{objectKey(p)})
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	result := results[0]
+	switch result.Status {
+	case service.ObjectNotFound:
+		w.Header().Set("Content-Type", "application/json; encode=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+	case service.ObjectFailed:
+		w.Header().Set("Content-Type", "application/json; encode=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	controller.JsonResponse(w, newDeleteResultBody(result))
+}
+
+// POST /storage/:bucket?delete
+func (ctrl *StorageControllerImpl) DeleteFiles(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+	if _, ok := r.URL.Query()["delete"]; !ok {
+		http.Error(w, "unknown operation", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody DeleteFilesReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
+	}
+
+	var results []*service.ObjectDeleteResult
+	var truncated bool
+	if reqBody.Prefix != nil {
+		results, truncated, err = ctrl.storageSvc.DeleteFilesByPrefix(user, p.ByName("bucket"), *reqBody.Prefix)
+	} else {
+		results, err = ctrl.storageSvc.DeleteFiles(user, p.ByName("bucket"), reqBody.Keys)
+	}
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := &DeleteFilesResBody{Results: make([]*DeleteResultBody, len(results)), Truncated: truncated}
+	for i, result := range results {
+		resBody.Results[i] = newDeleteResultBody(result)
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// GET /storage/:bucket
+func (ctrl *StorageControllerImpl) ListFiles(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	listing, err := ctrl.storageSvc.ListFiles(user, p.ByName("bucket"), query.Get("prefix"), query.Get("delimiter"), query.Get("cursor"), limit)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := &ListFilesResBody{Objects: []*ObjectBody{}, Prefixes: []string{}, NextCursor: listing.NextCursor}
+	for _, entry := range listing.Entries {
+		if entry.Object != nil {
+			resBody.Objects = append(resBody.Objects, newObjectBody(entry.Object))
+		} else {
+			resBody.Prefixes = append(resBody.Prefixes, entry.Prefix)
+		}
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// findFile reads the file with the signed URL or the optional authorization, and responds errors if failed.
+func (ctrl *StorageControllerImpl) findFile(w http.ResponseWriter, r *http.Request, p httprouter.Params) (*service.StorageFile, bool) {
+	var file *service.StorageFile
+	var err error
+	if query := r.URL.Query(); query.Get("signature") != "" {
+		var opts *service.SignedURLOptions
+		file, opts, err = ctrl.storageSvc.ReadSignedFile(p.ByName("bucket"), objectKey(p), r.Method, clientIP(r), query)
+		if opts != nil && opts.ContentDisposition != "" {
+			w.Header().Set("Content-Disposition", opts.ContentDisposition)
+		}
+	} else {
+		var user *model.UserIdentity
+		if r.Header.Get("Authorization") != "" {
+			user, err = ctrl.authSvc.Authenticate(r)
+			if err != nil {
+				controller.AuthErrorResponse(w, err)
+				return nil, false
+			}
+		}
+		file, err = ctrl.storageSvc.ReadFile(user, p.ByName("bucket"), objectKey(p))
+	}
+
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return nil, false
 	} else if file == nil {
 		http.Error(w, ErrNoSuchItem.Error(), http.StatusNotFound)
-		return
+		return nil, false
 	}
+	return file, true
+}
 
-	_, err = io.Copy(w, file)
+// clientIP returns the address of the connection, to check IP restrictions of signed URLs.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return r.RemoteAddr
 	}
+	return host
+}
+
+func objectKey(p httprouter.Params) string {
+	return strings.TrimPrefix(p.ByName("key"), "/")
+}
+
+func newObjectBody(object *model.StorageObject) *ObjectBody {
+	return &ObjectBody{
+		Key:          object.Key,
+		ContentType:  object.ContentType,
+		Size:         object.Size,
+		ETag:         object.ETag,
+		LastModified: object.UpdatedAt,
+	}
+}
+
+func newDeleteResultBody(result *service.ObjectDeleteResult) *DeleteResultBody {
+	return &DeleteResultBody{Key: result.Key, Status: result.Status, Error: result.Error}
 }
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/service"
+)
+
+type CreateUploadReqBody struct {
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Parts       int    `json:"parts"`
+}
+
+type UploadBody struct {
+	UploadID string            `json:"uploadId"`
+	Key      string            `json:"key"`
+	ExpireAt time.Time         `json:"expireAt"`
+	URL      string            `json:"url,omitempty"`
+	Parts    []*UploadPartBody `json:"parts,omitempty"`
+}
+
+type UploadPartBody struct {
+	PartNumber int64  `json:"partNumber"`
+	URL        string `json:"url,omitempty"`
+	ETag       string `json:"etag,omitempty"`
+}
+
+type CompleteUploadReqBody struct {
+	Parts []*UploadPartBody `json:"parts"`
+}
+
+// POST /storage/:bucket/:key(*)?uploads
+func (ctrl *StorageControllerImpl) createUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params, user *model.UserIdentity) {
+	var reqBody CreateUploadReqBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := ctrl.storageSvc.CreateUpload(user, p.ByName("bucket"), objectKey(p), reqBody.ContentType, reqBody.Size, reqBody.Parts)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := &UploadBody{
+		UploadID: session.Upload.UUID,
+		Key:      session.Upload.Key,
+		ExpireAt: session.Upload.ExpireAt,
+		URL:      session.URL,
+	}
+	for i, url := range session.PartURLs {
+		resBody.Parts = append(resBody.Parts, &UploadPartBody{PartNumber: int64(i + 1), URL: url})
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// POST /storage/:bucket/:key(*)?uploadId=
+func (ctrl *StorageControllerImpl) completeUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params, user *model.UserIdentity) {
+	var reqBody CompleteUploadReqBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parts := make([]*service.UploadedPart, len(reqBody.Parts))
+	for i, part := range reqBody.Parts {
+		if part == nil {
+			http.Error(w, "parts should not be null", http.StatusBadRequest)
+			return
+		}
+		parts[i] = &service.UploadedPart{PartNumber: part.PartNumber, ETag: part.ETag}
+	}
+	object, err := ctrl.storageSvc.CompleteUpload(user, p.ByName("bucket"), objectKey(p), r.URL.Query().Get("uploadId"), parts)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newObjectBody(object))
+}
+
+// DELETE /storage/:bucket/:key(*)?uploadId=
+func (ctrl *StorageControllerImpl) abortUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params, user *model.UserIdentity) {
+	err := ctrl.storageSvc.AbortUpload(user, p.ByName("bucket"), objectKey(p), r.URL.Query().Get("uploadId"))
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,39 +1,401 @@
 package vulcan
 
 import (
+	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/model"
 	"github.com/hellodhlyn/luppiter/service"
 	"github.com/julienschmidt/httprouter"
 )
 
+const statsDateLayout = "2006-01-02"
+
 type ApplicationsController interface {
 	Get(http.ResponseWriter, *http.Request, httprouter.Params)
+	List(http.ResponseWriter, *http.Request, httprouter.Params)
+	Create(http.ResponseWriter, *http.Request, httprouter.Params)
+	Update(http.ResponseWriter, *http.Request, httprouter.Params)
+	Delete(http.ResponseWriter, *http.Request, httprouter.Params)
+	ListSecrets(http.ResponseWriter, *http.Request, httprouter.Params)
+	CreateSecret(http.ResponseWriter, *http.Request, httprouter.Params)
+	UpdateSecret(http.ResponseWriter, *http.Request, httprouter.Params)
+	RetireSecret(http.ResponseWriter, *http.Request, httprouter.Params)
+	GetStats(http.ResponseWriter, *http.Request, httprouter.Params)
 }
 
 type ApplicationsControllerImpl struct {
-	svc service.ApplicationService
+	svc      service.ApplicationService
+	statsSvc service.StatsService
+	authSvc  service.AuthenticationService
 }
 
-func NewApplicationsController(appSvc service.ApplicationService) (ApplicationsController, error) {
-	return &ApplicationsControllerImpl{appSvc}, nil
+func NewApplicationsController(
+	appSvc service.ApplicationService,
+	statsSvc service.StatsService,
+	authSvc service.AuthenticationService,
+) (ApplicationsController, error) {
+	return &ApplicationsControllerImpl{appSvc, statsSvc, authSvc}, nil
 }
 
 type ApplicationBody struct {
-	UUID      string     `json:"uuid"`
-	Name      string     `json:"name"`
+	UUID           string           `json:"uuid"`
+	Name           string           `json:"name"`
+	AllowedOrigins []string         `json:"allowedOrigins"`
+	RedirectURIs   []string         `json:"redirectUris"`
+	TokenPolicy    *TokenPolicyBody `json:"tokenPolicy"`
+	CreatedAt      *time.Time       `json:"createdAt"`
+}
+
+// TokenPolicyBody has durations in seconds.
+type TokenPolicyBody struct {
+	TokenTTL           int64 `json:"tokenTtl"`
+	MaxSessionLifetime int64 `json:"maxSessionLifetime"`
+	IdleTimeout        int64 `json:"idleTimeout"`
+	RefreshAllowed     bool  `json:"refreshAllowed"`
+}
+
+type CreateApplicationReqBody struct {
+	Name             string `json:"name"`
+	OrganizationUUID string `json:"organizationUuid"`
+}
+
+type CreateApplicationResBody struct {
+	ApplicationBody
+	KID       string `json:"kid"`
+	SecretKey string `json:"secretKey"`
+}
+
+type UpdateApplicationReqBody struct {
+	Name           string           `json:"name"`
+	AllowedOrigins []string         `json:"allowedOrigins"`
+	RedirectURIs   []string         `json:"redirectUris"`
+	TokenPolicy    *TokenPolicyBody `json:"tokenPolicy"`
+}
+
+type ApplicationSecretBody struct {
+	KID       string     `json:"kid"`
+	Label     string     `json:"label"`
+	Active    bool       `json:"active"`
+	ExpireAt  *time.Time `json:"expireAt"`
+	RetiredAt *time.Time `json:"retiredAt"`
 	CreatedAt *time.Time `json:"createdAt"`
 }
 
+type ApplicationSecretReqBody struct {
+	Label    string     `json:"label"`
+	ExpireAt *time.Time `json:"expireAt"`
+}
+
+type CreateApplicationSecretResBody struct {
+	ApplicationSecretBody
+	SecretKey string `json:"secretKey"`
+}
+
+type ApplicationStatBody struct {
+	Date             string `json:"date"`
+	SignIns          int64  `json:"signIns"`
+	Activations      int64  `json:"activations"`
+	ActiveIdentities int64  `json:"activeIdentities"`
+	Requests         int64  `json:"requests"`
+}
+
 // GET /vulcan/applications/:uuid
 func (ctrl *ApplicationsControllerImpl) Get(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	app := ctrl.svc.FindByUUID(p.ByName("uuid"))
 
 	var resBody *ApplicationBody
 	if app != nil {
-		resBody = &ApplicationBody{UUID: app.UUID, Name: app.Name, CreatedAt: app.CreatedAt}
+		resBody = newApplicationBody(app)
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// GET /vulcan/applications
+func (ctrl *ApplicationsControllerImpl) List(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*ApplicationBody, 0)
+	for _, app := range ctrl.svc.ListApplications(user) {
+		resBody = append(resBody, newApplicationBody(app))
 	}
 	controller.JsonResponse(w, resBody)
 }
+
+// POST /vulcan/applications
+func (ctrl *ApplicationsControllerImpl) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody CreateApplicationReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app, err := ctrl.svc.CreateApplication(user, reqBody.Name, reqBody.OrganizationUUID)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	// The secret key is shown only once here, and can not be read again.
+	secret := app.Secrets[0]
+	controller.JsonResponse(w, &CreateApplicationResBody{ApplicationBody: *newApplicationBody(app), KID: secret.KID, SecretKey: secret.SecretKey})
+}
+
+// PUT /vulcan/applications/:uuid
+func (ctrl *ApplicationsControllerImpl) Update(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody UpdateApplicationReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	var policy *model.TokenPolicy
+	if body := reqBody.TokenPolicy; body != nil {
+		policy = &model.TokenPolicy{
+			TokenTTL:           body.TokenTTL,
+			MaxSessionLifetime: body.MaxSessionLifetime,
+			IdleTimeout:        body.IdleTimeout,
+			RefreshAllowed:     body.RefreshAllowed,
+		}
+	}
+
+	err = ctrl.svc.UpdateApplication(user, app, reqBody.Name, reqBody.AllowedOrigins, reqBody.RedirectURIs, policy)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newApplicationBody(app))
+}
+
+// DELETE /vulcan/applications/:uuid
+func (ctrl *ApplicationsControllerImpl) Delete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	app := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	err = ctrl.svc.DeleteApplication(user, app)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /vulcan/applications/:uuid/secrets
+func (ctrl *ApplicationsControllerImpl) ListSecrets(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	app := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	secrets, err := ctrl.svc.ListSecrets(user, app)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*ApplicationSecretBody, 0)
+	for _, secret := range secrets {
+		resBody = append(resBody, newApplicationSecretBody(secret))
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// POST /vulcan/applications/:uuid/secrets
+func (ctrl *ApplicationsControllerImpl) CreateSecret(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody ApplicationSecretReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	secret, err := ctrl.svc.CreateSecret(user, app, reqBody.Label, reqBody.ExpireAt)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	// The secret key is shown only once here, and can not be read again.
+	controller.JsonResponse(w, &CreateApplicationSecretResBody{ApplicationSecretBody: *newApplicationSecretBody(secret), SecretKey: secret.SecretKey})
+}
+
+// PUT /vulcan/applications/:uuid/secrets/:kid
+func (ctrl *ApplicationsControllerImpl) UpdateSecret(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody ApplicationSecretReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	secret, err := ctrl.svc.UpdateSecret(user, app, p.ByName("kid"), reqBody.Label, reqBody.ExpireAt)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newApplicationSecretBody(secret))
+}
+
+// DELETE /vulcan/applications/:uuid/secrets/:kid
+func (ctrl *ApplicationsControllerImpl) RetireSecret(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	app := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	err = ctrl.svc.RetireSecret(user, app, p.ByName("kid"))
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /vulcan/applications/:uuid/stats
+func (ctrl *ApplicationsControllerImpl) GetStats(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	// The last 30 days by default.
+	to := time.Now()
+	from := to.AddDate(0, 0, -29)
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(statsDateLayout, v); err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(statsDateLayout, v); err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+
+	app := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	stats, err := ctrl.statsSvc.GetStats(user, app, from, to)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*ApplicationStatBody, len(stats))
+	for i, stat := range stats {
+		resBody[i] = &ApplicationStatBody{
+			Date:             stat.Day.Format(statsDateLayout),
+			SignIns:          stat.SignIns,
+			Activations:      stat.Activations,
+			ActiveIdentities: stat.ActiveIdentities,
+			Requests:         stat.Requests,
+		}
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+func newApplicationBody(app *model.Application) *ApplicationBody {
+	return &ApplicationBody{
+		UUID:           app.UUID,
+		Name:           app.Name,
+		AllowedOrigins: append([]string{}, app.AllowedOrigins...),
+		RedirectURIs:   append([]string{}, app.RedirectURIs...),
+		TokenPolicy: &TokenPolicyBody{
+			TokenTTL:           app.TokenPolicy.TokenTTL,
+			MaxSessionLifetime: app.TokenPolicy.MaxSessionLifetime,
+			IdleTimeout:        app.TokenPolicy.IdleTimeout,
+			RefreshAllowed:     app.TokenPolicy.RefreshAllowed,
+		},
+		CreatedAt: app.CreatedAt,
+	}
+}
+
+func newApplicationSecretBody(secret *model.ApplicationSecret) *ApplicationSecretBody {
+	return &ApplicationSecretBody{
+		KID:       secret.KID,
+		Label:     secret.Label,
+		Active:    secret.IsActive(),
+		ExpireAt:  secret.ExpireAt,
+		RetiredAt: secret.RetiredAt,
+		CreatedAt: secret.CreatedAt,
+	}
+}
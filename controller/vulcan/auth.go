@@ -6,45 +6,115 @@ import (
 	"time"
 
 	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/model"
 	"github.com/hellodhlyn/luppiter/service"
 	"github.com/julienschmidt/httprouter"
 )
 
 type AuthController interface {
 	AuthByGoogle(http.ResponseWriter, *http.Request, httprouter.Params)
+	SendMagicLink(http.ResponseWriter, *http.Request, httprouter.Params)
+	AuthByMagicLink(http.ResponseWriter, *http.Request, httprouter.Params)
+	AuthAsGuest(http.ResponseWriter, *http.Request, httprouter.Params)
+	LinkGoogleAccount(http.ResponseWriter, *http.Request, httprouter.Params)
+	LinkByMagicLink(http.ResponseWriter, *http.Request, httprouter.Params)
 	ActivateAccessToken(http.ResponseWriter, *http.Request, httprouter.Params)
+	RefreshAccessToken(http.ResponseWriter, *http.Request, httprouter.Params)
+	GetConsentRequest(http.ResponseWriter, *http.Request, httprouter.Params)
+	Consent(http.ResponseWriter, *http.Request, httprouter.Params)
+	ListAuthorizedApps(http.ResponseWriter, *http.Request, httprouter.Params)
+	RevokeAuthorizedApp(http.ResponseWriter, *http.Request, httprouter.Params)
 	GetMe(http.ResponseWriter, *http.Request, httprouter.Params)
 }
 
 type AuthControllerImpl struct {
-	accountSvc service.UserAccountService
-	appSvc     service.ApplicationService
-	tokenSvc   service.AccessTokenService
-	authSvc    service.AuthenticationService
+	accountSvc   service.UserAccountService
+	magicLinkSvc service.MagicLinkService
+	guestSvc     service.GuestService
+	appSvc       service.ApplicationService
+	tokenSvc     service.AccessTokenService
+	consentSvc   service.ConsentService
+	authSvc      service.AuthenticationService
 }
 
 func NewAuthController(
 	accountSvc service.UserAccountService,
+	magicLinkSvc service.MagicLinkService,
+	guestSvc service.GuestService,
 	appSvc service.ApplicationService,
 	tokenSvc service.AccessTokenService,
+	consentSvc service.ConsentService,
 	authSvc service.AuthenticationService,
 ) (AuthController, error) {
-	return &AuthControllerImpl{accountSvc, appSvc, tokenSvc, authSvc}, nil
+	return &AuthControllerImpl{accountSvc, magicLinkSvc, guestSvc, appSvc, tokenSvc, consentSvc, authSvc}, nil
 }
 
 type MeResBody struct {
 	UUID     string `json:"uuid"`
 	Email    string `json:"email"`
 	Username string `json:"username"`
+	IsGuest  bool   `json:"isGuest"`
 }
 
 type SignInReqBody struct {
+	IDToken string   `json:"idToken"`
+	AppID   string   `json:"appId"`
+	Scopes  []string `json:"scopes"`
+}
+
+type GuestSignInReqBody struct {
+	AppID  string   `json:"appId"`
+	Scopes []string `json:"scopes"`
+}
+
+type LinkGoogleReqBody struct {
 	IDToken string `json:"idToken"`
-	AppID   string `json:"appId"`
+}
+
+type SendMagicLinkReqBody struct {
+	Email       string `json:"email"`
+	AppID       string `json:"appId"`
+	RedirectURI string `json:"redirectUri"`
+	Locale      string `json:"locale"`
+}
+
+type MagicLinkSignInReqBody struct {
+	Token  string   `json:"token"`
+	AppID  string   `json:"appId"`
+	Scopes []string `json:"scopes"`
 }
 
 type SignInResBody struct {
-	ActivationKey string `json:"activationKey"`
+	ActivationKey   string   `json:"activationKey"`
+	ConsentRequired bool     `json:"consentRequired"`
+	MissingScopes   []string `json:"missingScopes"`
+	ConsentURL      string   `json:"consentUrl,omitempty"`
+}
+
+type RefreshResBody struct {
+	AccessKey string     `json:"accessKey"`
+	ExpireAt  *time.Time `json:"expireAt"`
+}
+
+type ConsentReqBody struct {
+	Scopes []string `json:"scopes"`
+}
+
+type ConsentRequestBody struct {
+	Application *ConsentApplicationBody `json:"application"`
+	Scopes      []string                `json:"scopes"`
+}
+
+type ConsentApplicationBody struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+type AuthorizedAppBody struct {
+	UUID      string     `json:"uuid"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	GrantedAt *time.Time `json:"grantedAt"`
 }
 
 type ActivateReqBody struct {
@@ -61,10 +131,10 @@ type ActivateResBody struct {
 func (ctrl *AuthControllerImpl) GetMe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	user, err := ctrl.authSvc.Authenticate(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		controller.AuthErrorResponse(w, err)
 		return
 	}
-	controller.JsonResponse(w, &MeResBody{UUID: user.UUID, Email: user.Email, Username: user.Username})
+	controller.JsonResponse(w, newMeResBody(user))
 }
 
 // POST /vulcan/auth/signin/google
@@ -78,7 +148,132 @@ func (ctrl *AuthControllerImpl) AuthByGoogle(w http.ResponseWriter, r *http.Requ
 
 	account, err := ctrl.accountSvc.FindOrCreateByGoogleAccount(reqBody.IDToken)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(reqBody.AppID)
+	if app == nil {
+		http.Error(w, "invalid appId", http.StatusBadRequest)
+		return
+	}
+
+	ctrl.signIn(w, &account.Identity, app, reqBody.Scopes)
+}
+
+// POST /vulcan/auth/signin/email
+func (ctrl *AuthControllerImpl) SendMagicLink(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var reqBody SendMagicLinkReqBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(reqBody.AppID)
+	if app == nil {
+		http.Error(w, "invalid appId", http.StatusBadRequest)
+		return
+	}
+
+	err = ctrl.magicLinkSvc.SendMagicLink(reqBody.Email, app, reqBody.RedirectURI, reqBody.Locale)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// POST /vulcan/auth/signin/email/verify
+func (ctrl *AuthControllerImpl) AuthByMagicLink(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var reqBody MagicLinkSignInReqBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(reqBody.AppID)
+	if app == nil {
+		http.Error(w, "invalid appId", http.StatusBadRequest)
+		return
+	}
+
+	account, err := ctrl.magicLinkSvc.FindOrCreateByMagicLink(reqBody.Token, app)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	ctrl.signIn(w, &account.Identity, app, reqBody.Scopes)
+}
+
+// POST /vulcan/auth/signin/guest
+func (ctrl *AuthControllerImpl) AuthAsGuest(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var reqBody GuestSignInReqBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(reqBody.AppID)
+	if app == nil {
+		http.Error(w, "invalid appId", http.StatusBadRequest)
+		return
+	}
+
+	identity, err := ctrl.guestSvc.CreateGuest()
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	// Guests have nothing to share yet, so they are not asked for consent.
+	token, err := ctrl.tokenSvc.CreateAccessToken(identity, app, reqBody.Scopes)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	ctrl.consentSvc.Grant(identity, app, token.Scopes)
+	controller.JsonResponse(w, &SignInResBody{ActivationKey: token.ActivationKey, MissingScopes: []string{}})
+}
+
+// POST /vulcan/auth/link/google
+func (ctrl *AuthControllerImpl) LinkGoogleAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody LinkGoogleReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := ctrl.accountSvc.LinkGoogleAccount(user, reqBody.IDToken)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newMeResBody(&account.Identity))
+}
+
+// POST /vulcan/auth/link/email/verify
+func (ctrl *AuthControllerImpl) LinkByMagicLink(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody MagicLinkSignInReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -88,8 +283,12 @@ func (ctrl *AuthControllerImpl) AuthByGoogle(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	token, _ := ctrl.tokenSvc.CreateAccessToken(&account.Identity, app)
-	controller.JsonResponse(w, &SignInResBody{ActivationKey: token.ActivationKey})
+	account, err := ctrl.magicLinkSvc.LinkByMagicLink(user, reqBody.Token, app)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newMeResBody(&account.Identity))
 }
 
 // POST /vulcan/auth/activate
@@ -103,8 +302,137 @@ func (ctrl *AuthControllerImpl) ActivateAccessToken(w http.ResponseWriter, r *ht
 
 	token, err := ctrl.tokenSvc.ActivateAccessToken(reqBody.ActivationToken)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		controller.ErrorResponse(w, err)
 		return
 	}
 	controller.JsonResponse(w, &ActivateResBody{AccessKey: token.AccessKey, SecretKey: token.SecretKey, ExpireAt: token.ExpireAt})
 }
+
+// POST /vulcan/auth/refresh
+func (ctrl *AuthControllerImpl) RefreshAccessToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	token, err := ctrl.authSvc.AuthenticateToken(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	token, err = ctrl.tokenSvc.RefreshAccessToken(token)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, &RefreshResBody{AccessKey: token.AccessKey, ExpireAt: token.ExpireAt})
+}
+
+// GET /vulcan/auth/consent/:key
+//
+// Only for the consent page of the console, signed in as the user who is asked for consent.
+func (ctrl *AuthControllerImpl) GetConsentRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	session, err := ctrl.authSvc.AuthenticateToken(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	token, err := ctrl.consentSvc.FindConsentRequest(session, ps.ByName("key"))
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, &ConsentRequestBody{
+		Application: &ConsentApplicationBody{UUID: token.Application.UUID, Name: token.Application.Name},
+		Scopes:      token.ConsentScopes,
+	})
+}
+
+// POST /vulcan/auth/consent/:key
+//
+// Only for the consent page of the console, signed in as the user who is asked for consent.
+func (ctrl *AuthControllerImpl) Consent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	session, err := ctrl.authSvc.AuthenticateToken(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody ConsentReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	grant, err := ctrl.consentSvc.ApproveConsent(session, ps.ByName("key"), reqBody.Scopes)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newAuthorizedAppBody(grant))
+}
+
+// GET /vulcan/auth/authorized-apps
+func (ctrl *AuthControllerImpl) ListAuthorizedApps(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	grants := ctrl.consentSvc.ListGrants(user)
+	resBody := make([]*AuthorizedAppBody, len(grants))
+	for i, grant := range grants {
+		resBody[i] = newAuthorizedAppBody(grant)
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// DELETE /vulcan/auth/authorized-apps/:uuid
+func (ctrl *AuthControllerImpl) RevokeAuthorizedApp(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	if err := ctrl.consentSvc.Revoke(user, ps.ByName("uuid")); err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// signIn issues an access token for the signed-in identity, and tells whether the user should be asked for consent
+// on the console before activating it.
+func (ctrl *AuthControllerImpl) signIn(w http.ResponseWriter, identity *model.UserIdentity, app *model.Application, scopes []string) {
+	token, err := ctrl.tokenSvc.CreateAccessToken(identity, app, scopes)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	prompt, err := ctrl.consentSvc.RequestConsent(token)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	resBody := &SignInResBody{ActivationKey: token.ActivationKey, MissingScopes: []string{}}
+	if prompt != nil {
+		resBody.ConsentRequired = true
+		resBody.MissingScopes = prompt.Token.ConsentScopes
+		resBody.ConsentURL = prompt.URL
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+func newAuthorizedAppBody(grant *model.ConsentGrant) *AuthorizedAppBody {
+	return &AuthorizedAppBody{
+		UUID:      grant.Application.UUID,
+		Name:      grant.Application.Name,
+		Scopes:    grant.Scopes,
+		GrantedAt: grant.GrantedAt,
+	}
+}
+
+func newMeResBody(identity *model.UserIdentity) *MeResBody {
+	return &MeResBody{UUID: identity.UUID, Email: identity.Email, Username: identity.Username, IsGuest: identity.IsGuest}
+}
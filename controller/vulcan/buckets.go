@@ -0,0 +1,209 @@
+package vulcan
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/service"
+	"github.com/julienschmidt/httprouter"
+)
+
+type BucketsController interface {
+	List(http.ResponseWriter, *http.Request, httprouter.Params)
+	Create(http.ResponseWriter, *http.Request, httprouter.Params)
+	Update(http.ResponseWriter, *http.Request, httprouter.Params)
+	Delete(http.ResponseWriter, *http.Request, httprouter.Params)
+	SignURL(http.ResponseWriter, *http.Request, httprouter.Params)
+}
+
+type BucketsControllerImpl struct {
+	svc     service.StorageService
+	authSvc service.AuthenticationService
+}
+
+func NewBucketsController(storageSvc service.StorageService, authSvc service.AuthenticationService) (BucketsController, error) {
+	return &BucketsControllerImpl{storageSvc, authSvc}, nil
+}
+
+type BucketBody struct {
+	Name         string     `json:"name"`
+	IsPublic     bool       `json:"isPublic"`
+	CacheControl string     `json:"cacheControl"`
+	CreatedAt    *time.Time `json:"createdAt"`
+}
+
+type CreateBucketReqBody struct {
+	Name             string `json:"name"`
+	IsPublic         bool   `json:"isPublic"`
+	OrganizationUUID string `json:"organizationUuid"`
+}
+
+type UpdateBucketReqBody struct {
+	Name         string  `json:"name"`
+	IsPublic     *bool   `json:"isPublic"`
+	CacheControl *string `json:"cacheControl"`
+}
+
+type SignURLReqBody struct {
+	Key                string `json:"key"`
+	Method             string `json:"method"`
+	ExpiresIn          int64  `json:"expiresIn"`
+	IP                 string `json:"ip"`
+	ContentDisposition string `json:"contentDisposition"`
+}
+
+type SignURLResBody struct {
+	URL      string    `json:"url"`
+	ExpireAt time.Time `json:"expireAt"`
+}
+
+// GET /vulcan/buckets
+func (ctrl *BucketsControllerImpl) List(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*BucketBody, 0)
+	for _, bucket := range ctrl.svc.ListBuckets(user) {
+		resBody = append(resBody, newBucketBody(bucket))
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// POST /vulcan/buckets
+func (ctrl *BucketsControllerImpl) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody CreateBucketReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucket, err := ctrl.svc.CreateBucket(user, reqBody.Name, reqBody.OrganizationUUID, reqBody.IsPublic)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newBucketBody(bucket))
+}
+
+// PUT /vulcan/buckets/:name
+func (ctrl *BucketsControllerImpl) Update(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody UpdateBucketReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucket := ctrl.svc.FindBucket(p.ByName("name"))
+	if bucket == nil {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+
+	// Fields not given are left as they are.
+	name, isPublic, cacheControl := bucket.Name, bucket.IsPublic, bucket.CacheControl
+	if reqBody.Name != "" {
+		name = reqBody.Name
+	}
+	if reqBody.IsPublic != nil {
+		isPublic = *reqBody.IsPublic
+	}
+	if reqBody.CacheControl != nil {
+		cacheControl = *reqBody.CacheControl
+	}
+
+	err = ctrl.svc.UpdateBucket(user, bucket, name, isPublic, cacheControl)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newBucketBody(bucket))
+}
+
+// DELETE /vulcan/buckets/:name
+func (ctrl *BucketsControllerImpl) Delete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	bucket := ctrl.svc.FindBucket(p.ByName("name"))
+	if bucket == nil {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+
+	purge := r.URL.Query().Get("purge") == "true"
+	err = ctrl.svc.DeleteBucket(user, bucket, purge)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	if purge {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /vulcan/buckets/:name/signed-urls
+func (ctrl *BucketsControllerImpl) SignURL(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody SignURLReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if reqBody.ExpiresIn == 0 {
+		reqBody.ExpiresIn = 60 * 60
+	}
+
+	opts := &service.SignedURLOptions{
+		Method:             reqBody.Method,
+		ExpireAt:           time.Now().Add(time.Duration(reqBody.ExpiresIn) * time.Second).Truncate(time.Second),
+		IP:                 reqBody.IP,
+		ContentDisposition: reqBody.ContentDisposition,
+	}
+	signed, err := ctrl.svc.SignURL(user, p.ByName("name"), reqBody.Key, opts)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, &SignURLResBody{URL: signed, ExpireAt: opts.ExpireAt})
+}
+
+func newBucketBody(bucket *model.StorageBucket) *BucketBody {
+	return &BucketBody{
+		Name:         bucket.Name,
+		IsPublic:     bucket.IsPublic,
+		CacheControl: bucket.CacheControl,
+		CreatedAt:    bucket.CreatedAt,
+	}
+}
@@ -0,0 +1,170 @@
+package vulcan
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/service"
+)
+
+type OrganizationsController interface {
+	List(http.ResponseWriter, *http.Request, httprouter.Params)
+	Create(http.ResponseWriter, *http.Request, httprouter.Params)
+	ListMembers(http.ResponseWriter, *http.Request, httprouter.Params)
+	PutMember(http.ResponseWriter, *http.Request, httprouter.Params)
+	DeleteMember(http.ResponseWriter, *http.Request, httprouter.Params)
+}
+
+type OrganizationsControllerImpl struct {
+	svc     service.OrganizationService
+	authSvc service.AuthenticationService
+}
+
+func NewOrganizationsController(orgSvc service.OrganizationService, authSvc service.AuthenticationService) (OrganizationsController, error) {
+	return &OrganizationsControllerImpl{orgSvc, authSvc}, nil
+}
+
+type OrganizationBody struct {
+	UUID      string     `json:"uuid"`
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"createdAt"`
+}
+
+type OrganizationMemberBody struct {
+	UUID     string `json:"uuid"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type CreateOrganizationReqBody struct {
+	Name string `json:"name"`
+}
+
+type PutMemberReqBody struct {
+	Role string `json:"role"`
+}
+
+// GET /vulcan/organizations
+func (ctrl *OrganizationsControllerImpl) List(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*OrganizationBody, 0)
+	for _, org := range ctrl.svc.ListOrganizations(user) {
+		resBody = append(resBody, &OrganizationBody{UUID: org.UUID, Name: org.Name, CreatedAt: org.CreatedAt})
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// POST /vulcan/organizations
+func (ctrl *OrganizationsControllerImpl) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody CreateOrganizationReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	org, err := ctrl.svc.CreateOrganization(user, reqBody.Name)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, &OrganizationBody{UUID: org.UUID, Name: org.Name, CreatedAt: org.CreatedAt})
+}
+
+// GET /vulcan/organizations/:uuid/members
+func (ctrl *OrganizationsControllerImpl) ListMembers(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	org := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if org == nil {
+		http.Error(w, "no such organization", http.StatusNotFound)
+		return
+	}
+
+	members, err := ctrl.svc.ListMembers(user, org)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*OrganizationMemberBody, 0)
+	for _, member := range members {
+		resBody = append(resBody, newOrganizationMemberBody(member))
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// PUT /vulcan/organizations/:uuid/members/:identity
+func (ctrl *OrganizationsControllerImpl) PutMember(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody PutMemberReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	org := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if org == nil {
+		http.Error(w, "no such organization", http.StatusNotFound)
+		return
+	}
+
+	member, err := ctrl.svc.SetMemberRole(user, org, p.ByName("identity"), reqBody.Role)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newOrganizationMemberBody(member))
+}
+
+// DELETE /vulcan/organizations/:uuid/members/:identity
+func (ctrl *OrganizationsControllerImpl) DeleteMember(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	org := ctrl.svc.FindByUUID(p.ByName("uuid"))
+	if org == nil {
+		http.Error(w, "no such organization", http.StatusNotFound)
+		return
+	}
+
+	err = ctrl.svc.RemoveMember(user, org, p.ByName("identity"))
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newOrganizationMemberBody(member *model.OrganizationMember) *OrganizationMemberBody {
+	return &OrganizationMemberBody{UUID: member.Identity.UUID, Username: member.Identity.Username, Role: member.Role}
+}
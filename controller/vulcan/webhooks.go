@@ -0,0 +1,259 @@
+package vulcan
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/controller"
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/service"
+	"github.com/julienschmidt/httprouter"
+)
+
+const deliveriesPageSize = 50
+
+type WebhooksController interface {
+	List(http.ResponseWriter, *http.Request, httprouter.Params)
+	Create(http.ResponseWriter, *http.Request, httprouter.Params)
+	Update(http.ResponseWriter, *http.Request, httprouter.Params)
+	Delete(http.ResponseWriter, *http.Request, httprouter.Params)
+	ListDeliveries(http.ResponseWriter, *http.Request, httprouter.Params)
+	Redeliver(http.ResponseWriter, *http.Request, httprouter.Params)
+}
+
+type WebhooksControllerImpl struct {
+	appSvc     service.ApplicationService
+	webhookSvc service.WebhookService
+	authSvc    service.AuthenticationService
+}
+
+func NewWebhooksController(appSvc service.ApplicationService, webhookSvc service.WebhookService, authSvc service.AuthenticationService) (WebhooksController, error) {
+	return &WebhooksControllerImpl{appSvc, webhookSvc, authSvc}, nil
+}
+
+type WebhookBody struct {
+	UUID      string     `json:"uuid"`
+	URL       string     `json:"url"`
+	Events    []string   `json:"events"`
+	Active    bool       `json:"active"`
+	CreatedAt *time.Time `json:"createdAt"`
+}
+
+type CreateWebhookReqBody struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type CreateWebhookResBody struct {
+	WebhookBody
+	SigningSecret string `json:"signingSecret"`
+}
+
+type UpdateWebhookReqBody struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active bool     `json:"active"`
+}
+
+type WebhookDeliveryBody struct {
+	UUID           string     `json:"uuid"`
+	EventID        string     `json:"eventId"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt"`
+	ResponseStatus int        `json:"responseStatus"`
+	LastError      string     `json:"lastError"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+	CreatedAt      *time.Time `json:"createdAt"`
+}
+
+// GET /vulcan/applications/:uuid/webhooks
+func (ctrl *WebhooksControllerImpl) List(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	webhooks, err := ctrl.webhookSvc.ListWebhooks(user, app)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*WebhookBody, len(webhooks))
+	for i, webhook := range webhooks {
+		resBody[i] = newWebhookBody(webhook)
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// POST /vulcan/applications/:uuid/webhooks
+func (ctrl *WebhooksControllerImpl) Create(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody CreateWebhookReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	webhook, err := ctrl.webhookSvc.CreateWebhook(user, app, reqBody.URL, reqBody.Events)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	// The signing secret is shown only once here, and can not be read again.
+	controller.JsonResponse(w, &CreateWebhookResBody{WebhookBody: *newWebhookBody(webhook), SigningSecret: webhook.SigningSecret})
+}
+
+// PUT /vulcan/applications/:uuid/webhooks/:webhook
+func (ctrl *WebhooksControllerImpl) Update(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	var reqBody UpdateWebhookReqBody
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	webhook, err := ctrl.webhookSvc.UpdateWebhook(user, app, p.ByName("webhook"), reqBody.URL, reqBody.Events, reqBody.Active)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newWebhookBody(webhook))
+}
+
+// DELETE /vulcan/applications/:uuid/webhooks/:webhook
+func (ctrl *WebhooksControllerImpl) Delete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	if err := ctrl.webhookSvc.DeleteWebhook(user, app, p.ByName("webhook")); err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /vulcan/applications/:uuid/webhooks/:webhook/deliveries
+func (ctrl *WebhooksControllerImpl) ListDeliveries(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	deliveries, err := ctrl.webhookSvc.ListDeliveries(user, app, p.ByName("webhook"), offset, deliveriesPageSize)
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+
+	resBody := make([]*WebhookDeliveryBody, len(deliveries))
+	for i, delivery := range deliveries {
+		resBody[i] = newWebhookDeliveryBody(delivery)
+	}
+	controller.JsonResponse(w, resBody)
+}
+
+// POST /vulcan/applications/:uuid/webhooks/:webhook/deliveries/:delivery/redeliver
+func (ctrl *WebhooksControllerImpl) Redeliver(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, err := ctrl.authSvc.Authenticate(r)
+	if err != nil {
+		controller.AuthErrorResponse(w, err)
+		return
+	}
+
+	app := ctrl.appSvc.FindByUUID(p.ByName("uuid"))
+	if app == nil {
+		http.Error(w, "no such application", http.StatusNotFound)
+		return
+	}
+
+	delivery, err := ctrl.webhookSvc.Redeliver(user, app, p.ByName("webhook"), p.ByName("delivery"))
+	if err != nil {
+		controller.ErrorResponse(w, err)
+		return
+	}
+	controller.JsonResponse(w, newWebhookDeliveryBody(delivery))
+}
+
+func newWebhookBody(webhook *model.Webhook) *WebhookBody {
+	return &WebhookBody{
+		UUID:      webhook.UUID,
+		URL:       webhook.URL,
+		Events:    webhook.Events,
+		Active:    webhook.Active,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+func newWebhookDeliveryBody(delivery *model.WebhookDelivery) *WebhookDeliveryBody {
+	return &WebhookDeliveryBody{
+		UUID:           delivery.UUID,
+		EventID:        delivery.EventID,
+		Event:          delivery.Event,
+		Payload:        delivery.Payload,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		CreatedAt:      delivery.CreatedAt,
+	}
+}
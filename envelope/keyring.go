@@ -0,0 +1,186 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	prefix     = "enc"
+	dataKeyLen = 32
+)
+
+var ErrUnknownKeyVersion = errors.New("unknown master key version")
+
+// Keyring encrypts values with envelope encryption. Each value is encrypted by a random data key, and the data key is
+// wrapped by a master key. Encrypted values are formatted as `enc:<version>:<wrapped data key>:<ciphertext>`, so that
+// values encrypted by older master keys can still be decrypted after a new master key is introduced.
+type Keyring struct {
+	keys    map[string][]byte
+	current string
+}
+
+func NewKeyring(keys map[string][]byte, current string) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyVersion, current)
+	}
+	for version, key := range keys {
+		if strings.Contains(version, ":") {
+			return nil, fmt.Errorf("invalid master key version: %s", version)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master key %s should be 32 bytes", version)
+		}
+	}
+	return &Keyring{keys: keys, current: current}, nil
+}
+
+// NewKeyringFromEnv creates a keyring from `LUPPITER_MASTER_KEYS`, which is a comma-separated list of
+// `<version>:<base64 encoded 32 bytes key>`. New values are encrypted by the version of `LUPPITER_MASTER_KEY_VERSION`,
+// or by the last one in the list if not set.
+func NewKeyringFromEnv() (*Keyring, error) {
+	keys, current, err := ParseKeys(os.Getenv("LUPPITER_MASTER_KEYS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LUPPITER_MASTER_KEYS: %w", err)
+	}
+	if version, ok := os.LookupEnv("LUPPITER_MASTER_KEY_VERSION"); ok {
+		current = version
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("LUPPITER_MASTER_KEYS is not set")
+	}
+	return NewKeyring(keys, current)
+}
+
+// ParseKeys parses a comma-separated list of `<version>:<base64 encoded key>`, and returns the keys by versions with
+// the last version in the list.
+func ParseKeys(value string) (map[string][]byte, string, error) {
+	keys := map[string][]byte{}
+	last := ""
+	for _, entry := range strings.Split(value, ",") {
+		if entry == "" {
+			continue
+		}
+		splits := strings.SplitN(entry, ":", 2)
+		if len(splits) != 2 {
+			return nil, "", errors.New("keys should be formatted as `<version>:<key>`")
+		}
+		key, err := base64.StdEncoding.DecodeString(splits[1])
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid key %s: %w", splits[0], err)
+		}
+		keys[splits[0]] = key
+		last = splits[0]
+	}
+	return keys, last, nil
+}
+
+func (k *Keyring) CurrentVersion() string {
+	return k.current
+}
+
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	dataKey := make([]byte, dataKeyLen)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.current], dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		prefix,
+		k.current,
+		base64.RawURLEncoding.EncodeToString(wrapped),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+	}, ":"), nil
+}
+
+// Decrypt decrypts a value encrypted by any master key in the keyring. Values which are not encrypted are returned as
+// they are, so that rows written before encryption was introduced can be read until they are re-encrypted.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	splits := strings.Split(value, ":")
+	if len(splits) != 4 {
+		return "", errors.New("malformed encrypted value")
+	}
+	masterKey, ok := k.keys[splits[1]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKeyVersion, splits[1])
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(splits[2])
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(splits[3])
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := open(masterKey, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRewrap returns whether the value is not encrypted by the current master key.
+func (k *Keyring) NeedsRewrap(value string) bool {
+	return !strings.HasPrefix(value, prefix+":"+k.current+":")
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix+":")
+}
+
+// seal encrypts data with AES-GCM, and prepends the nonce to the ciphertext.
+func seal(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func open(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LocalMailer writes messages into a directory as `.eml` files, instead of sending them.
+type LocalMailer struct {
+	dir string
+}
+
+// LocalMessage is a summary of a message written by LocalMailer.
+type LocalMessage struct {
+	ID      string
+	To      string
+	Subject string
+	Date    time.Time
+}
+
+func NewLocalMailer(dir string) (*LocalMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalMailer{dir: dir}, nil
+}
+
+func (m *LocalMailer) Send(msg *Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	id := fmt.Sprintf("%d-%s", time.Now().UnixNano(), randomBoundary()[:8])
+	return ioutil.WriteFile(filepath.Join(m.dir, id+".eml"), msg.Bytes(), 0644)
+}
+
+// List returns the messages in the directory, the latest first.
+func (m *LocalMailer) List() ([]*LocalMessage, error) {
+	paths, err := filepath.Glob(filepath.Join(m.dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	messages := make([]*LocalMessage, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := mail.ReadMessage(file)
+		_ = file.Close()
+		if err != nil {
+			continue
+		}
+
+		date, _ := parsed.Header.Date()
+		subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		messages = append(messages, &LocalMessage{
+			ID:      strings.TrimSuffix(filepath.Base(path), ".eml"),
+			To:      parsed.Header.Get("To"),
+			Subject: subject,
+			Date:    date,
+		})
+	}
+	return messages, nil
+}
+
+// Read returns the raw content of the message.
+func (m *LocalMailer) Read(id string) ([]byte, error) {
+	if strings.ContainsAny(id, `/\.`) {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.ReadFile(filepath.Join(m.dir, id+".eml"))
+}
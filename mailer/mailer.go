@@ -0,0 +1,103 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	driverSMTP  = "smtp"
+	driverLocal = "local"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+type Message struct {
+	From     string
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+type Mailer interface {
+	Send(*Message) error
+}
+
+func getenvOrDefault(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// NewMailer creates a mailer for the driver configured by `LUPPITER_MAIL_DRIVER`. The `local` driver writes messages
+// into a directory instead of sending them, which is useful for development and tests.
+func NewMailer() (Mailer, error) {
+	switch driver := getenvOrDefault("LUPPITER_MAIL_DRIVER", driverLocal); driver {
+	case driverSMTP:
+		return NewSMTPMailer(
+			getenvOrDefault("SMTP_HOST", "127.0.0.1"),
+			getenvOrDefault("SMTP_PORT", "25"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+		)
+	case driverLocal:
+		return NewLocalMailer(getenvOrDefault("LUPPITER_MAIL_LOCAL_DIR", "tmp/mail"))
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", driver)
+	}
+}
+
+// Validate rejects line breaks in the addresses, which Bytes writes as they are, so that they can not inject headers.
+func (m *Message) Validate() error {
+	if strings.ContainsAny(m.From, "\r\n") || strings.ContainsAny(m.To, "\r\n") {
+		return fmt.Errorf("%w: line breaks are not allowed", ErrInvalidAddress)
+	}
+	return nil
+}
+
+// Bytes formats the message in RFC 5322. Messages with an HTML body are sent as `multipart/alternative`.
+func (m *Message) Bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.HTMLBody == "" {
+		writePart(&buf, "text/plain", m.TextBody)
+		return buf.Bytes()
+	}
+
+	boundary := randomBoundary()
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", boundary)
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	writePart(&buf, "text/plain", m.TextBody)
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", boundary)
+	writePart(&buf, "text/html", m.HTMLBody)
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", boundary)
+	return buf.Bytes()
+}
+
+func writePart(buf *bytes.Buffer, contentType, body string) {
+	fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(buf)
+	_, _ = w.Write([]byte(body))
+	_ = w.Close()
+}
+
+func randomBoundary() string {
+	bytes := make([]byte, 16)
+	_, _ = rand.Read(bytes)
+	return fmt.Sprintf("%x", bytes)
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(host, port, username, password string) (Mailer, error) {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{addr: net.JoinHostPort(host, port), auth: auth}, nil
+}
+
+// Send sends the message. Addresses may have display names such as `Luppiter <noreply@luppiter.dev>`, which are kept
+// only in the headers. The envelope has the bare addresses.
+func (m *SMTPMailer) Send(msg *Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("%w: sender: %v", ErrInvalidAddress, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: recipient: %v", ErrInvalidAddress, err)
+	}
+	return smtp.SendMail(m.addr, m.auth, from.Address, []string{to.Address}, msg.Bytes())
+}
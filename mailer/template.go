@@ -0,0 +1,85 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// localePattern matches language tags such as `ko`, `en-US` or `zh_Hant`, which are used in template filenames.
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z]{2,4})?$`)
+
+// IsValidLocale checks whether the locale is a language tag which is safe to use in filenames.
+func IsValidLocale(locale string) bool {
+	return localePattern.MatchString(locale)
+}
+
+// Templates renders messages from Go templates in a directory. A template consists of `<name>.<locale>.txt`, which
+// defines a `subject` block besides the text body, and an optional `<name>.<locale>.html` for the HTML body.
+type Templates struct {
+	dir           string
+	defaultLocale string
+}
+
+func NewTemplates(dir, defaultLocale string) *Templates {
+	return &Templates{dir: dir, defaultLocale: defaultLocale}
+}
+
+// Render renders the template in the given locale. If there is no template for the locale, such as `ko-KR`, it falls
+// back to the language (`ko`) and then to the default locale. Invalid locales are ignored.
+func (t *Templates) Render(name, locale string, data interface{}) (*Message, error) {
+	base := t.find(name, locale)
+	if base == "" {
+		return nil, fmt.Errorf("no such mail template: %s", name)
+	}
+
+	textTmpl, err := template.ParseFiles(base + ".txt")
+	if err != nil {
+		return nil, err
+	}
+	var subject, text bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	msg := &Message{Subject: strings.TrimSpace(subject.String()), TextBody: strings.TrimSpace(text.String())}
+
+	if _, err := os.Stat(base + ".html"); err == nil {
+		htmlTmpl, err := htmltemplate.ParseFiles(base + ".html")
+		if err != nil {
+			return nil, err
+		}
+		var html bytes.Buffer
+		if err := htmlTmpl.Execute(&html, data); err != nil {
+			return nil, err
+		}
+		msg.HTMLBody = html.String()
+	}
+	return msg, nil
+}
+
+func (t *Templates) find(name, locale string) string {
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, t.defaultLocale)
+
+	for _, candidate := range candidates {
+		if !IsValidLocale(candidate) {
+			continue
+		}
+		base := filepath.Join(t.dir, fmt.Sprintf("%s.%s", name, candidate))
+		if _, err := os.Stat(base + ".txt"); err == nil {
+			return base
+		}
+	}
+	return ""
+}
@@ -0,0 +1,12 @@
+begin;
+
+drop trigger applications_changed on applications;
+drop function notify_applications_changed();
+
+drop trigger user_identities_changed on user_identities;
+drop function notify_user_identities_changed();
+
+drop trigger access_tokens_changed on access_tokens;
+drop function notify_access_tokens_changed();
+
+commit;
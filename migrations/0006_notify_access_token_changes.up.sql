@@ -0,0 +1,36 @@
+begin;
+
+create function notify_access_tokens_changed() returns trigger as $$
+begin
+  perform pg_notify('access_tokens_changed', old.access_key);
+  return null;
+end;
+$$ language plpgsql;
+
+create trigger access_tokens_changed
+  after update or delete on access_tokens
+  for each row execute procedure notify_access_tokens_changed();
+
+create function notify_user_identities_changed() returns trigger as $$
+begin
+  perform pg_notify('user_identities_changed', old.id::text);
+  return null;
+end;
+$$ language plpgsql;
+
+create trigger user_identities_changed
+  after update or delete on user_identities
+  for each row execute procedure notify_user_identities_changed();
+
+create function notify_applications_changed() returns trigger as $$
+begin
+  perform pg_notify('applications_changed', old.id::text);
+  return null;
+end;
+$$ language plpgsql;
+
+create trigger applications_changed
+  after update or delete on applications
+  for each row execute procedure notify_applications_changed();
+
+commit;
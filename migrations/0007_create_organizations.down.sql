@@ -0,0 +1,9 @@
+begin;
+
+alter table storage_buckets drop column organization_id;
+alter table applications drop column organization_id;
+
+drop table organization_members;
+drop table organizations;
+
+commit;
@@ -0,0 +1,35 @@
+begin;
+
+create sequence organizations_id_seq;
+create table organizations (
+  id         integer not null primary key default nextval('organizations_id_seq'),
+  uuid       varchar(36) not null,
+  name       varchar(255) not null,
+  created_at timestamp with time zone default current_timestamp,
+  updated_at timestamp with time zone default current_timestamp
+);
+
+alter sequence organizations_id_seq owned by organizations.id;
+create unique index organizations_uuid_idx on organizations (uuid);
+
+create sequence organization_members_id_seq;
+create table organization_members (
+  id              integer not null primary key default nextval('organization_members_id_seq'),
+  organization_id integer not null,
+  identity_id     integer not null,
+  role            varchar(20) not null,
+  created_at      timestamp with time zone default current_timestamp,
+  updated_at      timestamp with time zone default current_timestamp
+);
+
+alter sequence organization_members_id_seq owned by organization_members.id;
+create unique index organization_members_organization_id_identity_id_idx on organization_members (organization_id, identity_id);
+create index organization_members_identity_id_idx on organization_members (identity_id);
+
+alter table applications add column organization_id integer;
+create index applications_organization_id_idx on applications (organization_id);
+
+alter table storage_buckets add column organization_id integer;
+create index storage_buckets_organization_id_idx on storage_buckets (organization_id);
+
+commit;
@@ -0,0 +1,6 @@
+begin;
+
+drop table admin_audit_logs;
+alter table user_identities drop column is_admin, drop column disabled;
+
+commit;
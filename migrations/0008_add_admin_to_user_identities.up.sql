@@ -0,0 +1,22 @@
+begin;
+
+alter table user_identities
+  add column is_admin boolean not null default false,
+  add column disabled boolean not null default false;
+
+create sequence admin_audit_logs_id_seq;
+create table admin_audit_logs (
+  id         integer not null primary key default nextval('admin_audit_logs_id_seq'),
+  actor_id   integer not null,
+  action     varchar(40) not null,
+  target     varchar(255) not null,
+  detail     text not null default '',
+  created_at timestamp with time zone default current_timestamp,
+  updated_at timestamp with time zone default current_timestamp
+);
+
+alter sequence admin_audit_logs_id_seq owned by admin_audit_logs.id;
+create index admin_audit_logs_actor_id_idx on admin_audit_logs (actor_id);
+create index admin_audit_logs_target_idx on admin_audit_logs (target);
+
+commit;
@@ -0,0 +1,8 @@
+begin;
+
+alter table user_identities add column disabled boolean not null default false;
+update user_identities set disabled = true where status <> 'active';
+
+alter table user_identities drop column status, drop column suspension_reason, drop column suspended_until;
+
+commit;
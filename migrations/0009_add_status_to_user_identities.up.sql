@@ -0,0 +1,11 @@
+begin;
+
+alter table user_identities
+  add column status            varchar(20) not null default 'active',
+  add column suspension_reason text not null default '',
+  add column suspended_until   timestamp with time zone;
+
+update user_identities set status = 'suspended' where disabled;
+alter table user_identities drop column disabled;
+
+commit;
@@ -0,0 +1,22 @@
+begin;
+
+create sequence mail_messages_id_seq;
+create table mail_messages (
+  id              integer not null primary key default nextval('mail_messages_id_seq'),
+  recipient       varchar(255) not null,
+  subject         varchar(255) not null,
+  text_body       text not null,
+  html_body       text not null default '',
+  status          varchar(20) not null default 'pending',
+  attempts        integer not null default 0,
+  next_attempt_at timestamp with time zone default current_timestamp,
+  last_error      text not null default '',
+  sent_at         timestamp with time zone,
+  created_at      timestamp with time zone default current_timestamp,
+  updated_at      timestamp with time zone default current_timestamp
+);
+
+alter sequence mail_messages_id_seq owned by mail_messages.id;
+create index mail_messages_status_next_attempt_at_idx on mail_messages (status, next_attempt_at);
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+drop table magic_links;
+
+commit;
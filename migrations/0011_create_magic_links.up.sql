@@ -0,0 +1,18 @@
+begin;
+
+create sequence magic_links_id_seq;
+create table magic_links (
+  id             integer not null primary key default nextval('magic_links_id_seq'),
+  token_hash     varchar(64) not null,
+  email          varchar(255) not null,
+  application_id integer not null,
+  expire_at      timestamp with time zone not null,
+  used_at        timestamp with time zone,
+  created_at     timestamp with time zone default current_timestamp,
+  updated_at     timestamp with time zone default current_timestamp
+);
+
+alter sequence magic_links_id_seq owned by magic_links.id;
+create unique index magic_links_token_hash_idx on magic_links (token_hash);
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+alter table user_identities drop column is_guest;
+
+commit;
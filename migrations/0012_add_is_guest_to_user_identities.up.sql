@@ -0,0 +1,6 @@
+begin;
+
+alter table user_identities add column is_guest boolean not null default false;
+create index user_identities_is_guest_created_at_idx on user_identities (created_at) where is_guest;
+
+commit;
@@ -0,0 +1,15 @@
+begin;
+
+alter table applications add column secret_key varchar (40) not null default '';
+
+update applications set secret_key = s.secret_key
+  from (
+    select distinct on (application_id) application_id, secret_key from application_secrets
+    where retired_at is null
+    order by application_id, id desc
+  ) s
+  where applications.id = s.application_id;
+
+drop table application_secrets;
+
+commit;
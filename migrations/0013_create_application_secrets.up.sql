@@ -0,0 +1,25 @@
+begin;
+
+create sequence application_secrets_id_seq;
+create table application_secrets (
+  id             integer not null primary key default nextval('application_secrets_id_seq'),
+  application_id integer not null,
+  kid            varchar(16) not null,
+  label          varchar(255) not null default '',
+  secret_key     varchar(40) not null,
+  expire_at      timestamp with time zone,
+  retired_at     timestamp with time zone,
+  created_at     timestamp with time zone default current_timestamp,
+  updated_at     timestamp with time zone default current_timestamp
+);
+
+alter sequence application_secrets_id_seq owned by application_secrets.id;
+create unique index application_secrets_kid_idx on application_secrets (kid);
+create index application_secrets_application_id_idx on application_secrets (application_id);
+
+insert into application_secrets (application_id, kid, label, secret_key)
+  select id, substr(md5(random()::text), 1, 16), 'default', secret_key from applications where secret_key <> '';
+
+alter table applications drop column secret_key;
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+alter table applications drop column allowed_origins, drop column redirect_uris;
+
+commit;
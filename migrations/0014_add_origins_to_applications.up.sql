@@ -0,0 +1,7 @@
+begin;
+
+alter table applications
+  add column allowed_origins text[] not null default '{}',
+  add column redirect_uris   text[] not null default '{}';
+
+commit;
@@ -0,0 +1,6 @@
+begin;
+
+alter table access_tokens alter column secret_key type varchar(40);
+alter table application_secrets alter column secret_key type varchar(40);
+
+commit;
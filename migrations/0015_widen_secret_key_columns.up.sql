@@ -0,0 +1,7 @@
+begin;
+
+-- Secret keys are stored encrypted, which are longer than plaintext ones.
+alter table access_tokens alter column secret_key type text;
+alter table application_secrets alter column secret_key type text;
+
+commit;
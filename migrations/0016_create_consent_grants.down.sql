@@ -0,0 +1,6 @@
+begin;
+
+alter table access_tokens drop column scopes;
+drop table consent_grants;
+
+commit;
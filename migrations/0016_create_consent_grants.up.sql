@@ -0,0 +1,23 @@
+begin;
+
+create sequence consent_grants_id_seq;
+create table consent_grants (
+  id             integer not null primary key default nextval('consent_grants_id_seq'),
+  identity_id    integer not null,
+  application_id integer not null,
+  scopes         text[] not null default '{}',
+  granted_at     timestamp with time zone default current_timestamp,
+  created_at     timestamp with time zone default current_timestamp,
+  updated_at     timestamp with time zone default current_timestamp
+);
+
+alter sequence consent_grants_id_seq owned by consent_grants.id;
+create unique index consent_grants_identity_id_application_id_idx on consent_grants (identity_id, application_id);
+
+alter table access_tokens add column scopes text[] not null default '{profile,email}';
+
+-- Users who already signed in to applications have agreed implicitly.
+insert into consent_grants (identity_id, application_id, scopes)
+  select distinct identity_id, application_id, '{profile,email}'::text[] from access_tokens where activated;
+
+commit;
@@ -0,0 +1,6 @@
+begin;
+
+drop table webhook_deliveries;
+drop table webhooks;
+
+commit;
@@ -0,0 +1,43 @@
+begin;
+
+create sequence webhooks_id_seq;
+create table webhooks (
+  id             integer not null primary key default nextval('webhooks_id_seq'),
+  uuid           varchar(36) not null,
+  application_id integer not null,
+  url            text not null,
+  events         text[] not null default '{}',
+  signing_secret text not null,
+  active         boolean not null default true,
+  created_at     timestamp with time zone default current_timestamp,
+  updated_at     timestamp with time zone default current_timestamp
+);
+
+alter sequence webhooks_id_seq owned by webhooks.id;
+create unique index webhooks_uuid_idx on webhooks (uuid);
+create index webhooks_application_id_idx on webhooks (application_id);
+
+create sequence webhook_deliveries_id_seq;
+create table webhook_deliveries (
+  id              integer not null primary key default nextval('webhook_deliveries_id_seq'),
+  uuid            varchar(36) not null,
+  webhook_id      integer not null,
+  event_id        varchar(36) not null,
+  event           varchar(64) not null,
+  payload         text not null,
+  status          varchar(20) not null default 'pending',
+  attempts        integer not null default 0,
+  next_attempt_at timestamp with time zone default current_timestamp,
+  response_status integer not null default 0,
+  last_error      text not null default '',
+  delivered_at    timestamp with time zone,
+  created_at      timestamp with time zone default current_timestamp,
+  updated_at      timestamp with time zone default current_timestamp
+);
+
+alter sequence webhook_deliveries_id_seq owned by webhook_deliveries.id;
+create unique index webhook_deliveries_uuid_idx on webhook_deliveries (uuid);
+create index webhook_deliveries_webhook_id_idx on webhook_deliveries (webhook_id, id);
+create index webhook_deliveries_status_next_attempt_at_idx on webhook_deliveries (status, next_attempt_at);
+
+commit;
@@ -0,0 +1,6 @@
+begin;
+
+drop table application_daily_identities;
+drop table application_daily_stats;
+
+commit;
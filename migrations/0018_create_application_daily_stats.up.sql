@@ -0,0 +1,20 @@
+begin;
+
+create table application_daily_stats (
+  application_id integer not null,
+  day            date not null,
+  sign_ins       bigint not null default 0,
+  activations    bigint not null default 0,
+  requests       bigint not null default 0,
+  primary key (application_id, day)
+);
+
+-- Identities which used applications, to count distinct ones per day.
+create table application_daily_identities (
+  application_id integer not null,
+  day            date not null,
+  identity_id    integer not null,
+  primary key (application_id, day, identity_id)
+);
+
+commit;
@@ -0,0 +1,13 @@
+begin;
+
+alter table access_tokens
+  drop column activated_at,
+  drop column last_used_at;
+
+alter table applications
+  drop column token_ttl,
+  drop column max_session_lifetime,
+  drop column idle_timeout,
+  drop column refresh_allowed;
+
+commit;
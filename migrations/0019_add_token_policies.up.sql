@@ -0,0 +1,15 @@
+begin;
+
+alter table applications
+  add column token_ttl            integer not null default 604800,
+  add column max_session_lifetime integer not null default 0,
+  add column idle_timeout         integer not null default 0,
+  add column refresh_allowed      boolean not null default false;
+
+alter table access_tokens
+  add column activated_at timestamp with time zone,
+  add column last_used_at timestamp with time zone;
+
+update access_tokens set activated_at = updated_at where activated;
+
+commit;
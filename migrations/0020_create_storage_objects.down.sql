@@ -0,0 +1,5 @@
+begin;
+
+drop table storage_objects;
+
+commit;
@@ -0,0 +1,18 @@
+begin;
+
+create sequence storage_objects_id_seq;
+create table storage_objects (
+  id           integer not null primary key default nextval('storage_objects_id_seq'),
+  bucket_id    integer not null,
+  key          varchar(1024) not null,
+  content_type varchar(255) not null default '',
+  size         bigint not null default 0,
+  etag         varchar(64) not null default '',
+  created_at   timestamp with time zone default current_timestamp,
+  updated_at   timestamp with time zone default current_timestamp
+);
+
+alter sequence storage_objects_id_seq owned by storage_objects.id;
+create unique index storage_objects_bucket_id_key_idx on storage_objects (bucket_id, key);
+
+commit;
@@ -0,0 +1,7 @@
+begin;
+
+alter table storage_buckets
+  drop column storage_prefix,
+  drop column purge_requested_at;
+
+commit;
@@ -0,0 +1,10 @@
+begin;
+
+-- Files of a bucket are stored under its prefix, so that renaming the bucket does not move them.
+alter table storage_buckets
+  add column storage_prefix     varchar(255) not null default '',
+  add column purge_requested_at timestamp with time zone;
+
+update storage_buckets set storage_prefix = name;
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+drop table storage_uploads;
+
+commit;
@@ -0,0 +1,22 @@
+begin;
+
+create sequence storage_uploads_id_seq;
+create table storage_uploads (
+  id           integer not null primary key default nextval('storage_uploads_id_seq'),
+  uuid         varchar(36) not null,
+  bucket_id    integer not null,
+  identity_id  integer not null,
+  key          varchar(1024) not null,
+  content_type varchar(255) not null default '',
+  size         bigint not null default 0,
+  multipart_id varchar(1024) not null default '',
+  expire_at    timestamp with time zone not null,
+  created_at   timestamp with time zone default current_timestamp,
+  updated_at   timestamp with time zone default current_timestamp
+);
+
+alter sequence storage_uploads_id_seq owned by storage_uploads.id;
+create unique index storage_uploads_uuid_idx on storage_uploads (uuid);
+create index storage_uploads_expire_at_idx on storage_uploads (expire_at);
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+alter table storage_buckets drop column cache_control;
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+alter table storage_buckets add column cache_control varchar(255) not null default '';
+
+commit;
@@ -0,0 +1,8 @@
+begin;
+
+drop index access_tokens_consent_key_idx;
+alter table access_tokens
+  drop column consent_key,
+  drop column consent_scopes;
+
+commit;
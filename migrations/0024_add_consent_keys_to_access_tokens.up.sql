@@ -0,0 +1,9 @@
+begin;
+
+alter table access_tokens
+  add column consent_key    varchar(64) not null default '',
+  add column consent_scopes text[] not null default '{}';
+
+create index access_tokens_consent_key_idx on access_tokens (consent_key) where consent_key <> '';
+
+commit;
@@ -0,0 +1,10 @@
+begin;
+
+drop trigger access_tokens_deleted on access_tokens;
+drop trigger access_tokens_changed on access_tokens;
+
+create trigger access_tokens_changed
+  after update or delete on access_tokens
+  for each row execute procedure notify_access_tokens_changed();
+
+commit;
@@ -0,0 +1,17 @@
+begin;
+
+-- Tokens are written once a minute while they are used, which should not evict them from caches of every instance.
+-- `new` can not be referenced by conditions of delete triggers, so deletes are notified by another trigger.
+drop trigger access_tokens_changed on access_tokens;
+
+create trigger access_tokens_changed
+  after update on access_tokens
+  for each row
+  when ((to_jsonb(old) - 'last_used_at') is distinct from (to_jsonb(new) - 'last_used_at'))
+  execute procedure notify_access_tokens_changed();
+
+create trigger access_tokens_deleted
+  after delete on access_tokens
+  for each row execute procedure notify_access_tokens_changed();
+
+commit;
@@ -2,6 +2,8 @@ package model
 
 import (
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type AccessToken struct {
@@ -16,10 +18,17 @@ type AccessToken struct {
 	SecretKey     string
 	ActivationKey string
 	Activated     bool
+	Scopes        pq.StringArray
+
+	// ConsentKey identifies the consent request of the token, which asks the user for ConsentScopes on the consent page.
+	ConsentKey    string
+	ConsentScopes pq.StringArray
 
-	ExpireAt *time.Time
+	ExpireAt    *time.Time
+	ActivatedAt *time.Time
+	LastUsedAt  *time.Time
 }
 
 func (t *AccessToken) HasExpired() bool {
-	return t.ExpireAt.Before(time.Now())
+	return t.ExpireAt == nil || t.ExpireAt.Before(time.Now())
 }
@@ -0,0 +1,19 @@
+package model
+
+const (
+	AdminActionSetIdentityStatus   = "identity.status"
+	AdminActionRevokeTokens        = "identity.revoke_tokens"
+	AdminActionTransferApplication = "application.transfer"
+	AdminActionTransferBucket      = "bucket.transfer"
+	AdminActionViewBucket          = "bucket.view"
+)
+
+// AdminAuditLog records an action taken by a system administrator.
+type AdminAuditLog struct {
+	ModelMixin
+	ActorID int64
+	Actor   UserIdentity
+	Action  string
+	Target  string
+	Detail  string
+}
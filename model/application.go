@@ -1,10 +1,29 @@
 package model
 
+import "github.com/lib/pq"
+
 type Application struct {
 	ModelMixin
-	UUID      string
-	Name      string
-	OwnerID   int
-	Owner     UserIdentity
-	SecretKey string
+	UUID           string
+	Name           string
+	OwnerID        int
+	Owner          UserIdentity
+	OrganizationID *int64
+	Secrets        []ApplicationSecret
+
+	// AllowedOrigins are origins of frontends allowed to call APIs by CORS, such as `https://example.com`.
+	AllowedOrigins pq.StringArray
+	// RedirectURIs are URIs which sign-in flows are allowed to redirect to.
+	RedirectURIs pq.StringArray
+
+	TokenPolicy TokenPolicy `gorm:"embedded"`
+}
+
+func (app *Application) IsRedirectURIAllowed(uri string) bool {
+	for _, allowed := range app.RedirectURIs {
+		if allowed == uri {
+			return true
+		}
+	}
+	return false
 }
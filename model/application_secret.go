@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// ApplicationSecret is a secret key of an application, used to sign activation tokens. An application may have
+// several active secrets at once, so that a secret can be rotated without downtime.
+type ApplicationSecret struct {
+	ModelMixin
+	ApplicationID int64
+	KID           string `gorm:"column:kid"`
+	Label         string
+	SecretKey     string
+	ExpireAt      *time.Time
+	RetiredAt     *time.Time
+}
+
+func (s *ApplicationSecret) IsActive() bool {
+	now := time.Now()
+	return s.RetiredAt == nil && (s.ExpireAt == nil || s.ExpireAt.After(now))
+}
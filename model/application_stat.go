@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// ApplicationDailyStat is the usage of an application in a day, in UTC.
+type ApplicationDailyStat struct {
+	ApplicationID    int64
+	Day              time.Time
+	SignIns          int64
+	Activations      int64
+	Requests         int64
+	ActiveIdentities int64 `gorm:"-"`
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Scopes of user data which applications can request on sign-in.
+const (
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var DefaultScopes = []string{ScopeProfile, ScopeEmail}
+
+func IsValidScope(scope string) bool {
+	return scope == ScopeProfile || scope == ScopeEmail
+}
+
+// ConsentGrant records that an identity agreed to share its data of the scopes with an application.
+type ConsentGrant struct {
+	ModelMixin
+	IdentityID    int64
+	ApplicationID int64
+	Application   Application
+	Scopes        pq.StringArray
+	GrantedAt     *time.Time
+}
+
+// Covers returns whether every scope is granted.
+func (g *ConsentGrant) Covers(scopes []string) bool {
+	return len(g.MissingScopes(scopes)) == 0
+}
+
+func (g *ConsentGrant) MissingScopes(scopes []string) []string {
+	missing := make([]string, 0)
+	for _, scope := range scopes {
+		granted := false
+		for _, s := range g.Scopes {
+			if s == scope {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
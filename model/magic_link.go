@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// MagicLink is a single-use sign-in link sent by email. Only the hash of the token is stored.
+type MagicLink struct {
+	ModelMixin
+	TokenHash     string
+	Email         string
+	ApplicationID int64
+	Application   Application
+	ExpireAt      *time.Time
+	UsedAt        *time.Time
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const (
+	MailStatusPending = "pending"
+	MailStatusSent    = "sent"
+	MailStatusFailed  = "failed"
+)
+
+// MailMessage is an outbound email in the send queue.
+type MailMessage struct {
+	ModelMixin
+	Recipient string
+	Subject   string
+	TextBody  string
+	HTMLBody  string
+
+	Status        string
+	Attempts      int
+	NextAttemptAt *time.Time
+	LastError     string
+	SentAt        *time.Time
+}
@@ -0,0 +1,26 @@
+package model
+
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+type Organization struct {
+	ModelMixin
+	UUID    string
+	Name    string
+	Members []OrganizationMember
+}
+
+type OrganizationMember struct {
+	ModelMixin
+	OrganizationID int64
+	IdentityID     int64
+	Identity       UserIdentity
+	Role           string
+}
+
+func IsValidOrganizationRole(role string) bool {
+	return role == OrganizationRoleOwner || role == OrganizationRoleAdmin || role == OrganizationRoleMember
+}
@@ -1,9 +1,20 @@
 package model
 
+import "time"
+
 type StorageBucket struct {
 	ModelMixin
-	OwnerID  int64
-	Owner    UserIdentity
-	Name     string
-	IsPublic bool
+	OwnerID        int64
+	Owner          UserIdentity
+	OrganizationID *int64
+	Name           string
+	IsPublic       bool
+
+	// CacheControl of files of the bucket, if it is public. A default is used if empty.
+	CacheControl string
+
+	// StoragePrefix is the prefix of files of the bucket in the backend, which does not change on renames.
+	StoragePrefix string
+	// PurgeRequestedAt is set when the bucket is deleted with its files, until the files are purged.
+	PurgeRequestedAt *time.Time
 }
@@ -0,0 +1,17 @@
+package model
+
+// StorageObject is the metadata of a file in a storage bucket. `UpdatedAt` is the last modified time.
+type StorageObject struct {
+	ModelMixin
+	BucketID    int64
+	Key         string
+	ContentType string
+	Size        int64
+	ETag        string `gorm:"column:etag"`
+}
+
+// StorageListEntry is either an object, or a common prefix of objects grouped by the delimiter in listings.
+type StorageListEntry struct {
+	Prefix string
+	Object *StorageObject
+}
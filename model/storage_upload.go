@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// StorageUpload is a session of uploading a file directly to S3 with presigned URLs. The file is recorded as a
+// StorageObject when the upload is completed. Size is only for single uploads, and MultipartID only for multipart ones.
+type StorageUpload struct {
+	ModelMixin
+	UUID        string
+	BucketID    int64
+	IdentityID  int64
+	Key         string
+	ContentType string
+	Size        int64
+	MultipartID string
+	ExpireAt    time.Time
+}
+
+func (upload *StorageUpload) IsMultipart() bool {
+	return upload.MultipartID != ""
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// Default token policy, which was applied to every application before policies became configurable.
+const (
+	DefaultTokenTTL = 7 * 24 * 60 * 60
+)
+
+// TokenPolicy decides how long access tokens of an application last. Durations are in seconds, and zero means no
+// limit except for the TTL.
+type TokenPolicy struct {
+	// TokenTTL is the lifetime of an access token from the activation, or from the last refresh.
+	TokenTTL int64 `gorm:"column:token_ttl"`
+	// MaxSessionLifetime is the absolute lifetime from the activation, which refreshes can not extend.
+	MaxSessionLifetime int64 `gorm:"column:max_session_lifetime"`
+	// IdleTimeout expires access tokens not used for the duration.
+	IdleTimeout int64 `gorm:"column:idle_timeout"`
+	// RefreshAllowed allows extending access tokens by the TTL before they expire.
+	RefreshAllowed bool `gorm:"column:refresh_allowed"`
+}
+
+// ExpireAt returns when a token issued at the time expires, within the maximum session lifetime.
+func (p *TokenPolicy) ExpireAt(activatedAt, issuedAt time.Time) time.Time {
+	expireAt := issuedAt.Add(time.Duration(p.TokenTTL) * time.Second)
+	if sessionEnd := p.SessionExpireAt(activatedAt); sessionEnd != nil && sessionEnd.Before(expireAt) {
+		expireAt = *sessionEnd
+	}
+	return expireAt
+}
+
+// SessionExpireAt returns the end of a session activated at the time, or nil if sessions have no absolute limit.
+func (p *TokenPolicy) SessionExpireAt(activatedAt time.Time) *time.Time {
+	if p.MaxSessionLifetime == 0 {
+		return nil
+	}
+	t := activatedAt.Add(time.Duration(p.MaxSessionLifetime) * time.Second)
+	return &t
+}
+
+// IdleExpireAt returns when a token last used at the time expires by the idle timeout, or nil if there is no timeout.
+func (p *TokenPolicy) IdleExpireAt(lastUsedAt time.Time) *time.Time {
+	if p.IdleTimeout == 0 {
+		return nil
+	}
+	t := lastUsedAt.Add(time.Duration(p.IdleTimeout) * time.Second)
+	return &t
+}
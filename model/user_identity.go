@@ -1,9 +1,38 @@
 package model
 
+import "time"
+
+const (
+	IdentityStatusActive          = "active"
+	IdentityStatusSuspended       = "suspended"
+	IdentityStatusPendingDeletion = "pending_deletion"
+)
+
 type UserIdentity struct {
 	ModelMixin
 	UUID     string
 	Username string
 	Email    string
 	Accounts []UserAccount
+	IsAdmin  bool
+	IsGuest  bool
+
+	Status           string
+	SuspensionReason string
+	SuspendedUntil   *time.Time
+}
+
+// EffectiveStatus returns the status of the identity, regarding a suspension which has already ended as active.
+func (i *UserIdentity) EffectiveStatus() string {
+	if i.Status == IdentityStatusSuspended && i.SuspendedUntil != nil && i.SuspendedUntil.Before(time.Now()) {
+		return IdentityStatusActive
+	}
+	if i.Status == "" {
+		return IdentityStatusActive
+	}
+	return i.Status
+}
+
+func IsValidIdentityStatus(status string) bool {
+	return status == IdentityStatusActive || status == IdentityStatusSuspended || status == IdentityStatusPendingDeletion
 }
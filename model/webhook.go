@@ -0,0 +1,65 @@
+package model
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Events which applications can subscribe to by webhooks.
+const (
+	WebhookEventConsentRevoked       = "consent.revoked"
+	WebhookEventIdentityDeleted      = "identity.deleted"
+	WebhookEventIdentityEmailChanged = "identity.email_changed"
+)
+
+func IsValidWebhookEvent(event string) bool {
+	switch event {
+	case WebhookEventConsentRevoked, WebhookEventIdentityDeleted, WebhookEventIdentityEmailChanged:
+		return true
+	}
+	return false
+}
+
+// Webhook is an endpoint of an application, which receives events signed by its signing secret.
+type Webhook struct {
+	ModelMixin
+	UUID          string
+	ApplicationID int64
+	URL           string
+	Events        pq.StringArray
+	SigningSecret string
+	Active        bool
+}
+
+func (w *Webhook) Subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	WebhookDeliveryStatusPending   = "pending"
+	WebhookDeliveryStatusDelivered = "delivered"
+	WebhookDeliveryStatusFailed    = "failed"
+)
+
+// WebhookDelivery is an event sent, or to be sent, to a webhook.
+type WebhookDelivery struct {
+	ModelMixin
+	UUID      string
+	WebhookID int64
+	EventID   string
+	Event     string
+	Payload   string
+
+	Status         string
+	Attempts       int
+	NextAttemptAt  *time.Time
+	ResponseStatus int
+	LastError      string
+	DeliveredAt    *time.Time
+}
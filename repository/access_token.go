@@ -1,22 +1,37 @@
 package repository
 
 import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/envelope"
 	"github.com/hellodhlyn/luppiter/model"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 )
 
 type AccessTokenRepository interface {
 	FindByAccessKey(string) *model.AccessToken
 	FindByActivationKey(string) *model.AccessToken
-	Save(*model.AccessToken)
+	FindByConsentKey(string) *model.AccessToken
+	Save(*model.AccessToken) error
+	DeleteByIdentityID(identityID int64)
+	DeleteByApplicationID(applicationID int64)
+	DeleteByIdentityAndApplication(identityID, applicationID int64)
+	UpdateLastUsedAt(token *model.AccessToken, t time.Time)
+	UpdateExpiry(token *model.AccessToken, expireAt, lastUsedAt time.Time)
+	UpdateConsent(token *model.AccessToken, consentKey string, scopes []string)
 }
 
+// AccessTokenRepositoryImpl stores secret keys of access tokens encrypted by the keyring.
 type AccessTokenRepositoryImpl struct {
-	db *gorm.DB
+	db      *gorm.DB
+	keyring *envelope.Keyring
 }
 
-func NewAccessTokenRepository(db *gorm.DB) (AccessTokenRepository, error) {
-	return &AccessTokenRepositoryImpl{db}, nil
+func NewAccessTokenRepository(db *gorm.DB, keyring *envelope.Keyring) (AccessTokenRepository, error) {
+	return &AccessTokenRepositoryImpl{db, keyring}, nil
 }
 
 func (repo *AccessTokenRepositoryImpl) FindByAccessKey(accessKey string) *model.AccessToken {
@@ -25,7 +40,7 @@ func (repo *AccessTokenRepositoryImpl) FindByAccessKey(accessKey string) *model.
 	if token.ID == 0 {
 		return nil
 	}
-	return &token
+	return repo.decrypt(&token)
 }
 
 func (repo *AccessTokenRepositoryImpl) FindByActivationKey(activationKey string) *model.AccessToken {
@@ -34,9 +49,76 @@ func (repo *AccessTokenRepositoryImpl) FindByActivationKey(activationKey string)
 	if token.ID == 0 {
 		return nil
 	}
-	return &token
+	return repo.decrypt(&token)
+}
+
+func (repo *AccessTokenRepositoryImpl) FindByConsentKey(consentKey string) *model.AccessToken {
+	if consentKey == "" {
+		return nil
+	}
+	var token model.AccessToken
+	repo.db.Where(&model.AccessToken{ConsentKey: consentKey}).Preload("Identity").Preload("Application").First(&token)
+	if token.ID == 0 {
+		return nil
+	}
+	return repo.decrypt(&token)
+}
+
+// Save encrypts the secret key and saves the token, without its identity and application which may be stale copies.
+// The token is not saved if the encryption fails.
+func (repo *AccessTokenRepositoryImpl) Save(token *model.AccessToken) error {
+	secretKey := token.SecretKey
+	encrypted, err := repo.keyring.Encrypt(secretKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the secret key of access token: %w", err)
+	}
+
+	token.SecretKey = encrypted
+	err = repo.db.Set("gorm:association_autoupdate", false).Save(token).Error
+	token.SecretKey = secretKey
+	return err
+}
+
+func (repo *AccessTokenRepositoryImpl) DeleteByIdentityID(identityID int64) {
+	repo.db.Where(&model.AccessToken{IdentityID: identityID}).Delete(&model.AccessToken{})
+}
+
+func (repo *AccessTokenRepositoryImpl) DeleteByApplicationID(applicationID int64) {
+	repo.db.Where(&model.AccessToken{ApplicationID: applicationID}).Delete(&model.AccessToken{})
+}
+
+func (repo *AccessTokenRepositoryImpl) decrypt(token *model.AccessToken) *model.AccessToken {
+	secretKey, err := repo.keyring.Decrypt(token.SecretKey)
+	if err != nil {
+		log.Printf("failed to decrypt the secret key of access token %d: %v", token.ID, err)
+		return nil
+	}
+	token.SecretKey = secretKey
+	return token
+}
+
+func (repo *AccessTokenRepositoryImpl) DeleteByIdentityAndApplication(identityID, applicationID int64) {
+	repo.db.Where(&model.AccessToken{IdentityID: identityID, ApplicationID: applicationID}).Delete(&model.AccessToken{})
+}
+
+// UpdateLastUsedAt only updates the last used time, without saving the whole token.
+func (repo *AccessTokenRepositoryImpl) UpdateLastUsedAt(token *model.AccessToken, t time.Time) {
+	repo.db.Model(&model.AccessToken{}).Where("id = ?", token.ID).UpdateColumn("last_used_at", t)
+	token.LastUsedAt = &t
+}
+
+// UpdateExpiry only updates the expiry and the last used time, without saving the whole token and its associations.
+func (repo *AccessTokenRepositoryImpl) UpdateExpiry(token *model.AccessToken, expireAt, lastUsedAt time.Time) {
+	repo.db.Model(&model.AccessToken{}).Where("id = ?", token.ID).
+		UpdateColumns(map[string]interface{}{"expire_at": expireAt, "last_used_at": lastUsedAt})
+	token.ExpireAt = &expireAt
+	token.LastUsedAt = &lastUsedAt
 }
 
-func (repo *AccessTokenRepositoryImpl) Save(token *model.AccessToken) {
-	repo.db.Save(token)
+// UpdateConsent only updates the consent request of the token, without saving the whole token.
+func (repo *AccessTokenRepositoryImpl) UpdateConsent(token *model.AccessToken, consentKey string, scopes []string) {
+	repo.db.Model(&model.AccessToken{}).Where("id = ?", token.ID).
+		UpdateColumns(map[string]interface{}{"consent_key": consentKey, "consent_scopes": pq.StringArray(scopes)})
+	token.ConsentKey = consentKey
+	token.ConsentScopes = scopes
 }
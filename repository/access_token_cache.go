@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+// Channels notified by database triggers when rows are changed. See migrations/0006.
+const (
+	channelAccessTokensChanged   = "access_tokens_changed"
+	channelUserIdentitiesChanged = "user_identities_changed"
+	ChannelApplicationsChanged   = "applications_changed"
+)
+
+var CacheInvalidationChannels = []string{channelAccessTokensChanged, channelUserIdentitiesChanged, ChannelApplicationsChanged}
+
+// CachedAccessTokenRepository keeps recently resolved access tokens in memory, so that authenticating a request does
+// not hit the database every time. Entries are evicted when they expire, when the cache is full, or when the listener
+// receives a change notification from the database. Entries are indexed by identities and applications as well, so
+// that evicting them does not scan the whole cache.
+type CachedAccessTokenRepository struct {
+	AccessTokenRepository
+
+	mu            sync.Mutex
+	size          int
+	ttl           time.Duration
+	entries       *list.List
+	items         map[string]*list.Element
+	byIdentity    map[int64]map[*list.Element]struct{}
+	byApplication map[int64]map[*list.Element]struct{}
+}
+
+type accessTokenCacheEntry struct {
+	token    model.AccessToken
+	expireAt time.Time
+}
+
+func NewCachedAccessTokenRepository(repo AccessTokenRepository, listener *pq.Listener, size int, ttl time.Duration) (AccessTokenRepository, error) {
+	cached := &CachedAccessTokenRepository{
+		AccessTokenRepository: repo,
+		size:                  size,
+		ttl:                   ttl,
+		entries:               list.New(),
+		items:                 map[string]*list.Element{},
+		byIdentity:            map[int64]map[*list.Element]struct{}{},
+		byApplication:         map[int64]map[*list.Element]struct{}{},
+	}
+	if listener != nil {
+		go cached.listen(listener)
+	}
+	return cached, nil
+}
+
+func (repo *CachedAccessTokenRepository) FindByAccessKey(accessKey string) *model.AccessToken {
+	if token := repo.get(accessKey); token != nil {
+		return token
+	}
+
+	token := repo.AccessTokenRepository.FindByAccessKey(accessKey)
+	if token != nil && token.Activated {
+		repo.put(token)
+	}
+	return token
+}
+
+func (repo *CachedAccessTokenRepository) Save(token *model.AccessToken) error {
+	err := repo.AccessTokenRepository.Save(token)
+	repo.evictAccessKey(token.AccessKey)
+	return err
+}
+
+func (repo *CachedAccessTokenRepository) DeleteByIdentityID(identityID int64) {
+	repo.AccessTokenRepository.DeleteByIdentityID(identityID)
+	repo.evictIdentity(identityID, nil)
+}
+
+func (repo *CachedAccessTokenRepository) DeleteByApplicationID(applicationID int64) {
+	repo.AccessTokenRepository.DeleteByApplicationID(applicationID)
+	repo.evictApplication(applicationID)
+}
+
+func (repo *CachedAccessTokenRepository) DeleteByIdentityAndApplication(identityID, applicationID int64) {
+	repo.AccessTokenRepository.DeleteByIdentityAndApplication(identityID, applicationID)
+	repo.evictIdentity(identityID, func(entry *accessTokenCacheEntry) bool {
+		return entry.token.ApplicationID == applicationID
+	})
+}
+
+// UpdateLastUsedAt updates the cached token in place rather than evicting it, since the token is written once a
+// minute while it is used. Database triggers do not notify updates of only the last used time either.
+func (repo *CachedAccessTokenRepository) UpdateLastUsedAt(token *model.AccessToken, t time.Time) {
+	repo.AccessTokenRepository.UpdateLastUsedAt(token, t)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if elem, ok := repo.items[token.AccessKey]; ok {
+		elem.Value.(*accessTokenCacheEntry).token.LastUsedAt = &t
+	}
+}
+
+func (repo *CachedAccessTokenRepository) UpdateExpiry(token *model.AccessToken, expireAt, lastUsedAt time.Time) {
+	repo.AccessTokenRepository.UpdateExpiry(token, expireAt, lastUsedAt)
+	repo.evictAccessKey(token.AccessKey)
+}
+
+func (repo *CachedAccessTokenRepository) get(accessKey string) *model.AccessToken {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	elem, ok := repo.items[accessKey]
+	if !ok {
+		return nil
+	}
+
+	entry := elem.Value.(*accessTokenCacheEntry)
+	if entry.expireAt.Before(time.Now()) {
+		repo.remove(elem)
+		return nil
+	}
+	repo.entries.MoveToFront(elem)
+
+	// Return a copy, so that callers can not modify the cached one.
+	token := entry.token
+	return &token
+}
+
+func (repo *CachedAccessTokenRepository) put(token *model.AccessToken) {
+	expireAt := time.Now().Add(repo.ttl)
+	if token.ExpireAt != nil && token.ExpireAt.Before(expireAt) {
+		expireAt = *token.ExpireAt
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if elem, ok := repo.items[token.AccessKey]; ok {
+		repo.remove(elem)
+	}
+	elem := repo.entries.PushFront(&accessTokenCacheEntry{token: *token, expireAt: expireAt})
+	repo.items[token.AccessKey] = elem
+	index(repo.byIdentity, token.IdentityID, elem)
+	index(repo.byApplication, token.ApplicationID, elem)
+	for repo.entries.Len() > repo.size {
+		repo.remove(repo.entries.Back())
+	}
+}
+
+func (repo *CachedAccessTokenRepository) evictAccessKey(accessKey string) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if elem, ok := repo.items[accessKey]; ok {
+		repo.remove(elem)
+	}
+}
+
+// evictIdentity evicts tokens of the identity which match, or all of them if match is nil.
+func (repo *CachedAccessTokenRepository) evictIdentity(identityID int64, match func(*accessTokenCacheEntry) bool) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for elem := range repo.byIdentity[identityID] {
+		if match == nil || match(elem.Value.(*accessTokenCacheEntry)) {
+			repo.remove(elem)
+		}
+	}
+}
+
+func (repo *CachedAccessTokenRepository) evictApplication(applicationID int64) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for elem := range repo.byApplication[applicationID] {
+		repo.remove(elem)
+	}
+}
+
+func (repo *CachedAccessTokenRepository) evictAll() {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.entries.Init()
+	repo.items = map[string]*list.Element{}
+	repo.byIdentity = map[int64]map[*list.Element]struct{}{}
+	repo.byApplication = map[int64]map[*list.Element]struct{}{}
+}
+
+func (repo *CachedAccessTokenRepository) remove(elem *list.Element) {
+	entry := repo.entries.Remove(elem).(*accessTokenCacheEntry)
+	delete(repo.items, entry.token.AccessKey)
+	unindex(repo.byIdentity, entry.token.IdentityID, elem)
+	unindex(repo.byApplication, entry.token.ApplicationID, elem)
+}
+
+func index(indexes map[int64]map[*list.Element]struct{}, id int64, elem *list.Element) {
+	if indexes[id] == nil {
+		indexes[id] = map[*list.Element]struct{}{}
+	}
+	indexes[id][elem] = struct{}{}
+}
+
+func unindex(indexes map[int64]map[*list.Element]struct{}, id int64, elem *list.Element) {
+	delete(indexes[id], elem)
+	if len(indexes[id]) == 0 {
+		delete(indexes, id)
+	}
+}
+
+func (repo *CachedAccessTokenRepository) listen(listener *pq.Listener) {
+	for notification := range listener.Notify {
+		// A nil notification is sent after the listener reconnected, and notifications may have been lost meanwhile.
+		if notification == nil {
+			repo.evictAll()
+			continue
+		}
+
+		switch notification.Channel {
+		case channelAccessTokensChanged:
+			repo.evictAccessKey(notification.Extra)
+		case channelUserIdentitiesChanged:
+			id, _ := strconv.ParseInt(notification.Extra, 10, 64)
+			repo.evictIdentity(id, nil)
+		case ChannelApplicationsChanged:
+			id, _ := strconv.ParseInt(notification.Extra, 10, 64)
+			repo.evictApplication(id)
+		}
+	}
+}
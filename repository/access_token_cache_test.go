@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+// fakeAccessTokenRepository keeps tokens in memory, and counts lookups which would hit the database.
+type fakeAccessTokenRepository struct {
+	AccessTokenRepository
+
+	mu      sync.Mutex
+	tokens  map[string]*model.AccessToken
+	lookups int
+}
+
+func newFakeAccessTokenRepository(tokens ...*model.AccessToken) *fakeAccessTokenRepository {
+	repo := &fakeAccessTokenRepository{tokens: map[string]*model.AccessToken{}}
+	for _, token := range tokens {
+		repo.tokens[token.AccessKey] = token
+	}
+	return repo
+}
+
+func (repo *fakeAccessTokenRepository) FindByAccessKey(accessKey string) *model.AccessToken {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.lookups++
+	token, ok := repo.tokens[accessKey]
+	if !ok {
+		return nil
+	}
+	copied := *token
+	return &copied
+}
+
+func (repo *fakeAccessTokenRepository) UpdateLastUsedAt(token *model.AccessToken, t time.Time) {
+	token.LastUsedAt = &t
+}
+
+func (repo *fakeAccessTokenRepository) DeleteByIdentityAndApplication(int64, int64) {}
+
+func (repo *fakeAccessTokenRepository) lookupCount() int {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	return repo.lookups
+}
+
+func newTestAccessToken(accessKey string, identityID, applicationID int64) *model.AccessToken {
+	expireAt := time.Now().Add(time.Hour)
+	return &model.AccessToken{
+		IdentityID:    identityID,
+		ApplicationID: applicationID,
+		AccessKey:     accessKey,
+		Activated:     true,
+		ExpireAt:      &expireAt,
+	}
+}
+
+func TestCachedAccessTokenRepository_FindByAccessKey(t *testing.T) {
+	fake := newFakeAccessTokenRepository(newTestAccessToken("access-key", 1, 1))
+	repo, _ := NewCachedAccessTokenRepository(fake, nil, 10, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if token := repo.FindByAccessKey("access-key"); token == nil {
+			t.Fatalf("expected the token, got nil")
+		}
+	}
+	if lookups := fake.lookupCount(); lookups != 1 {
+		t.Errorf("expected 1 lookup, got %d", lookups)
+	}
+}
+
+func TestCachedAccessTokenRepository_EvictsOnNotification(t *testing.T) {
+	tests := []struct {
+		name         string
+		notification *pq.Notification
+	}{
+		{"access token changed", &pq.Notification{Channel: channelAccessTokensChanged, Extra: "access-key"}},
+		{"identity changed", &pq.Notification{Channel: channelUserIdentitiesChanged, Extra: strconv.Itoa(2)}},
+		{"application changed", &pq.Notification{Channel: ChannelApplicationsChanged, Extra: strconv.Itoa(3)}},
+		{"listener reconnected", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeAccessTokenRepository(
+				newTestAccessToken("access-key", 2, 3),
+				newTestAccessToken("other-key", 4, 5),
+			)
+			notify := make(chan *pq.Notification)
+			listener := &pq.Listener{Notify: notify}
+			repo, _ := NewCachedAccessTokenRepository(fake, listener, 10, time.Minute)
+			defer close(notify)
+
+			repo.FindByAccessKey("access-key")
+			repo.FindByAccessKey("other-key")
+
+			notify <- tt.notification
+			// The channel is unbuffered, so the previous notification is handled once this one is received.
+			notify <- &pq.Notification{Channel: "unknown"}
+
+			repo.FindByAccessKey("access-key")
+			if lookups := fake.lookupCount(); lookups != 3 {
+				t.Errorf("expected the entry to be evicted, got %d lookups", lookups)
+			}
+
+			repo.FindByAccessKey("other-key")
+			expected := 3
+			if tt.notification == nil {
+				expected = 4
+			}
+			if lookups := fake.lookupCount(); lookups != expected {
+				t.Errorf("expected %d lookups, got %d", expected, lookups)
+			}
+		})
+	}
+}
+
+func TestCachedAccessTokenRepository_UpdateLastUsedAt(t *testing.T) {
+	fake := newFakeAccessTokenRepository(newTestAccessToken("access-key", 1, 1))
+	repo, _ := NewCachedAccessTokenRepository(fake, nil, 10, time.Minute)
+
+	now := time.Now()
+	repo.UpdateLastUsedAt(repo.FindByAccessKey("access-key"), now)
+	token := repo.FindByAccessKey("access-key")
+	if lookups := fake.lookupCount(); lookups != 1 {
+		t.Errorf("expected the entry to be kept, got %d lookups", lookups)
+	}
+	if token.LastUsedAt == nil || !token.LastUsedAt.Equal(now) {
+		t.Errorf("expected the cached token to be used at %v, got %v", now, token.LastUsedAt)
+	}
+}
+
+func TestCachedAccessTokenRepository_DeleteByIdentityAndApplication(t *testing.T) {
+	fake := newFakeAccessTokenRepository(
+		newTestAccessToken("key-1", 1, 1),
+		newTestAccessToken("key-2", 1, 2),
+		newTestAccessToken("key-3", 2, 1),
+	)
+	repo, _ := NewCachedAccessTokenRepository(fake, nil, 10, time.Minute)
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		repo.FindByAccessKey(key)
+	}
+
+	repo.DeleteByIdentityAndApplication(1, 1)
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		repo.FindByAccessKey(key)
+	}
+	if lookups := fake.lookupCount(); lookups != 4 {
+		t.Errorf("expected only key-1 to be evicted, got %d lookups", lookups)
+	}
+}
+
+func TestCachedAccessTokenRepository_Expiry(t *testing.T) {
+	fake := newFakeAccessTokenRepository(newTestAccessToken("access-key", 1, 1))
+	repo, _ := NewCachedAccessTokenRepository(fake, nil, 10, time.Millisecond)
+
+	repo.FindByAccessKey("access-key")
+	time.Sleep(5 * time.Millisecond)
+	repo.FindByAccessKey("access-key")
+	if lookups := fake.lookupCount(); lookups != 2 {
+		t.Errorf("expected the entry to expire, got %d lookups", lookups)
+	}
+}
+
+func TestCachedAccessTokenRepository_Size(t *testing.T) {
+	fake := newFakeAccessTokenRepository(
+		newTestAccessToken("key-1", 1, 1),
+		newTestAccessToken("key-2", 2, 1),
+		newTestAccessToken("key-3", 3, 1),
+	)
+	repo, _ := NewCachedAccessTokenRepository(fake, nil, 2, time.Minute)
+
+	repo.FindByAccessKey("key-1")
+	repo.FindByAccessKey("key-2")
+	repo.FindByAccessKey("key-3") // Evicts key-1, the least recently used.
+	repo.FindByAccessKey("key-3")
+	repo.FindByAccessKey("key-2")
+	if lookups := fake.lookupCount(); lookups != 3 {
+		t.Errorf("expected 3 lookups, got %d", lookups)
+	}
+	repo.FindByAccessKey("key-1")
+	if lookups := fake.lookupCount(); lookups != 4 {
+		t.Errorf("expected key-1 to be evicted, got %d lookups", lookups)
+	}
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type AdminAuditLogRepository interface {
+	FindAll(offset, limit int) []*model.AdminAuditLog
+	Save(log *model.AdminAuditLog)
+}
+
+type AdminAuditLogRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAdminAuditLogRepository(db *gorm.DB) (AdminAuditLogRepository, error) {
+	return &AdminAuditLogRepositoryImpl{db}, nil
+}
+
+func (repo *AdminAuditLogRepositoryImpl) FindAll(offset, limit int) []*model.AdminAuditLog {
+	var logs []*model.AdminAuditLog
+	repo.db.Preload("Actor").Order("id desc").Offset(offset).Limit(limit).Find(&logs)
+	return logs
+}
+
+// Save saves the log without its actor, which may be a stale copy.
+func (repo *AdminAuditLogRepositoryImpl) Save(log *model.AdminAuditLog) {
+	repo.db.Set("gorm:association_autoupdate", false).Save(log)
+}
@@ -7,6 +7,11 @@ import (
 
 type ApplicationRepository interface {
 	FindByUUID(uuid string) *model.Application
+	FindByName(name string) *model.Application
+	FindByIdentityID(identityID int64) []*model.Application
+	FindAllowedOrigins() []string
+	Save(app *model.Application)
+	Delete(app *model.Application) error
 }
 
 type ApplicationRepositoryImpl struct {
@@ -25,3 +30,72 @@ func (repo *ApplicationRepositoryImpl) FindByUUID(uuid string) *model.Applicatio
 	}
 	return &application
 }
+
+func (repo *ApplicationRepositoryImpl) FindByName(name string) *model.Application {
+	var application model.Application
+	repo.db.Where(&model.Application{Name: name}).First(&application)
+	if application.ID == 0 {
+		return nil
+	}
+	return &application
+}
+
+// FindByIdentityID finds applications owned by the identity, or by organizations which the identity belongs to.
+func (repo *ApplicationRepositoryImpl) FindByIdentityID(identityID int64) []*model.Application {
+	var applications []*model.Application
+	repo.db.
+		Where("owner_id = ? or organization_id in (select organization_id from organization_members where identity_id = ?)", identityID, identityID).
+		Order("id").
+		Find(&applications)
+	return applications
+}
+
+// FindAllowedOrigins returns the union of allowed origins of every application.
+func (repo *ApplicationRepositoryImpl) FindAllowedOrigins() []string {
+	var origins []string
+	rows, err := repo.db.Raw("select distinct unnest(allowed_origins) from applications").Rows()
+	if err != nil {
+		return origins
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var origin string
+		if rows.Scan(&origin) == nil {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// Save saves the application without its owner, which may be a stale copy.
+func (repo *ApplicationRepositoryImpl) Save(app *model.Application) {
+	repo.db.Set("gorm:association_autoupdate", false).Save(app)
+}
+
+// Delete deletes the application in a transaction, with its access tokens, consent grants, secrets, webhooks, pending
+// sign-in links and statistics.
+func (repo *ApplicationRepositoryImpl) Delete(app *model.Application) error {
+	webhooks := repo.db.Table("webhooks").Select("id").Where("application_id = ?", app.ID).SubQuery()
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id in ?", webhooks).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		for _, value := range []interface{}{
+			&model.AccessToken{},
+			&model.ConsentGrant{},
+			&model.ApplicationSecret{},
+			&model.Webhook{},
+			&model.MagicLink{},
+			&model.ApplicationDailyStat{},
+		} {
+			if err := tx.Where("application_id = ?", app.ID).Delete(value).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("delete from application_daily_identities where application_id = ?", app.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(app).Error
+	})
+}
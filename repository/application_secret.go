@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/hellodhlyn/luppiter/envelope"
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type ApplicationSecretRepository interface {
+	FindByApplicationID(applicationID int64) []*model.ApplicationSecret
+	FindByKID(applicationID int64, kid string) *model.ApplicationSecret
+	Save(secret *model.ApplicationSecret) error
+}
+
+// ApplicationSecretRepositoryImpl stores secret keys encrypted by the keyring.
+type ApplicationSecretRepositoryImpl struct {
+	db      *gorm.DB
+	keyring *envelope.Keyring
+}
+
+func NewApplicationSecretRepository(db *gorm.DB, keyring *envelope.Keyring) (ApplicationSecretRepository, error) {
+	return &ApplicationSecretRepositoryImpl{db, keyring}, nil
+}
+
+func (repo *ApplicationSecretRepositoryImpl) FindByApplicationID(applicationID int64) []*model.ApplicationSecret {
+	var secrets []*model.ApplicationSecret
+	repo.db.Where(&model.ApplicationSecret{ApplicationID: applicationID}).Order("id").Find(&secrets)
+
+	decrypted := make([]*model.ApplicationSecret, 0, len(secrets))
+	for _, secret := range secrets {
+		if repo.decrypt(secret) != nil {
+			decrypted = append(decrypted, secret)
+		}
+	}
+	return decrypted
+}
+
+func (repo *ApplicationSecretRepositoryImpl) FindByKID(applicationID int64, kid string) *model.ApplicationSecret {
+	var secret model.ApplicationSecret
+	repo.db.Where(&model.ApplicationSecret{ApplicationID: applicationID, KID: kid}).First(&secret)
+	if secret.ID == 0 {
+		return nil
+	}
+	return repo.decrypt(&secret)
+}
+
+// Save encrypts the secret key and saves the secret. The secret is not saved if the encryption fails.
+func (repo *ApplicationSecretRepositoryImpl) Save(secret *model.ApplicationSecret) error {
+	secretKey := secret.SecretKey
+	encrypted, err := repo.keyring.Encrypt(secretKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the application secret: %w", err)
+	}
+
+	secret.SecretKey = encrypted
+	err = repo.db.Save(secret).Error
+	secret.SecretKey = secretKey
+	return err
+}
+
+func (repo *ApplicationSecretRepositoryImpl) decrypt(secret *model.ApplicationSecret) *model.ApplicationSecret {
+	secretKey, err := repo.keyring.Decrypt(secret.SecretKey)
+	if err != nil {
+		log.Printf("failed to decrypt the application secret %d: %v", secret.ID, err)
+		return nil
+	}
+	secret.SecretKey = secretKey
+	return secret
+}
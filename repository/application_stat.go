@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type ApplicationStatRepository interface {
+	FindByApplicationID(applicationID int64, from, to time.Time) []*model.ApplicationDailyStat
+	AddCounts(stat *model.ApplicationDailyStat)
+	AddActiveIdentities(applicationID int64, day time.Time, identityIDs []int64)
+}
+
+type ApplicationStatRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewApplicationStatRepository(db *gorm.DB) (ApplicationStatRepository, error) {
+	return &ApplicationStatRepositoryImpl{db}, nil
+}
+
+// FindByApplicationID returns stats of days between from and to, both inclusive. Days without any usage are omitted.
+func (repo *ApplicationStatRepositoryImpl) FindByApplicationID(applicationID int64, from, to time.Time) []*model.ApplicationDailyStat {
+	rows, err := repo.db.Raw(`
+		select s.application_id, s.day, s.sign_ins, s.activations, s.requests,
+		  (select count(*) from application_daily_identities i where i.application_id = s.application_id and i.day = s.day)
+		from application_daily_stats s
+		where s.application_id = ? and s.day between ? and ?
+		order by s.day`,
+		applicationID, from.Format("2006-01-02"), to.Format("2006-01-02"),
+	).Rows()
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var stats []*model.ApplicationDailyStat
+	for rows.Next() {
+		var stat model.ApplicationDailyStat
+		if err := rows.Scan(&stat.ApplicationID, &stat.Day, &stat.SignIns, &stat.Activations, &stat.Requests, &stat.ActiveIdentities); err == nil {
+			stats = append(stats, &stat)
+		}
+	}
+	return stats
+}
+
+// AddCounts adds the counts of the stat to the ones already stored.
+func (repo *ApplicationStatRepositoryImpl) AddCounts(stat *model.ApplicationDailyStat) {
+	repo.db.Exec(`
+		insert into application_daily_stats (application_id, day, sign_ins, activations, requests) values (?, ?, ?, ?, ?)
+		on conflict (application_id, day) do update set
+		  sign_ins = application_daily_stats.sign_ins + excluded.sign_ins,
+		  activations = application_daily_stats.activations + excluded.activations,
+		  requests = application_daily_stats.requests + excluded.requests`,
+		stat.ApplicationID, stat.Day.Format("2006-01-02"), stat.SignIns, stat.Activations, stat.Requests,
+	)
+}
+
+func (repo *ApplicationStatRepositoryImpl) AddActiveIdentities(applicationID int64, day time.Time, identityIDs []int64) {
+	if len(identityIDs) == 0 {
+		return
+	}
+	repo.db.Exec(`
+		insert into application_daily_identities (application_id, day, identity_id)
+		select ?, ?, unnest(?::integer[])
+		on conflict do nothing`,
+		applicationID, day.Format("2006-01-02"), pq.Array(identityIDs),
+	)
+}
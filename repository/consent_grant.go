@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type ConsentGrantRepository interface {
+	Find(identityID, applicationID int64) *model.ConsentGrant
+	FindByIdentityID(identityID int64) []*model.ConsentGrant
+	Save(grant *model.ConsentGrant)
+	Delete(grant *model.ConsentGrant)
+	DeleteByApplicationID(applicationID int64)
+}
+
+type ConsentGrantRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewConsentGrantRepository(db *gorm.DB) (ConsentGrantRepository, error) {
+	return &ConsentGrantRepositoryImpl{db}, nil
+}
+
+func (repo *ConsentGrantRepositoryImpl) Find(identityID, applicationID int64) *model.ConsentGrant {
+	var grant model.ConsentGrant
+	repo.db.Where(&model.ConsentGrant{IdentityID: identityID, ApplicationID: applicationID}).First(&grant)
+	if grant.ID == 0 {
+		return nil
+	}
+	return &grant
+}
+
+func (repo *ConsentGrantRepositoryImpl) FindByIdentityID(identityID int64) []*model.ConsentGrant {
+	var grants []*model.ConsentGrant
+	repo.db.Where(&model.ConsentGrant{IdentityID: identityID}).Preload("Application").Order("granted_at desc").Find(&grants)
+	return grants
+}
+
+// Save saves the grant without its application, which may be a stale copy.
+func (repo *ConsentGrantRepositoryImpl) Save(grant *model.ConsentGrant) {
+	repo.db.Set("gorm:association_autoupdate", false).Save(grant)
+}
+
+func (repo *ConsentGrantRepositoryImpl) Delete(grant *model.ConsentGrant) {
+	repo.db.Delete(grant)
+}
+
+func (repo *ConsentGrantRepositoryImpl) DeleteByApplicationID(applicationID int64) {
+	repo.db.Where(&model.ConsentGrant{ApplicationID: applicationID}).Delete(&model.ConsentGrant{})
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type MagicLinkRepository interface {
+	Consume(tokenHash string, applicationID int64) *model.MagicLink
+	Save(link *model.MagicLink)
+}
+
+type MagicLinkRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewMagicLinkRepository(db *gorm.DB) (MagicLinkRepository, error) {
+	return &MagicLinkRepositoryImpl{db}, nil
+}
+
+// Consume marks an unused and unexpired link of the application as used, and returns it. It returns nil if there is
+// no such link, so that a link can not be used twice even by concurrent requests. Links of other applications are left
+// unused.
+func (repo *MagicLinkRepositoryImpl) Consume(tokenHash string, applicationID int64) *model.MagicLink {
+	var link model.MagicLink
+	repo.db.Raw(`
+		update magic_links set used_at = current_timestamp, updated_at = current_timestamp
+		where token_hash = ? and application_id = ? and used_at is null and expire_at > current_timestamp
+		returning *`,
+		tokenHash, applicationID,
+	).Scan(&link)
+	if link.ID == 0 {
+		return nil
+	}
+	return &link
+}
+
+func (repo *MagicLinkRepositoryImpl) Save(link *model.MagicLink) {
+	repo.db.Save(link)
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type MailMessageRepository interface {
+	ClaimDue(limit int, lease time.Duration) []*model.MailMessage
+	Save(message *model.MailMessage)
+}
+
+type MailMessageRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewMailMessageRepository(db *gorm.DB) (MailMessageRepository, error) {
+	return &MailMessageRepositoryImpl{db}, nil
+}
+
+// ClaimDue finds pending messages to send, and postpones their next attempt by the lease so that other API instances
+// do not send them at the same time.
+func (repo *MailMessageRepositoryImpl) ClaimDue(limit int, lease time.Duration) []*model.MailMessage {
+	var messages []*model.MailMessage
+	repo.db.Raw(`
+		update mail_messages set next_attempt_at = ? where id in (
+			select id from mail_messages
+			where status = ? and next_attempt_at <= current_timestamp
+			order by next_attempt_at limit ?
+			for update skip locked
+		) returning *`,
+		time.Now().Add(lease), model.MailStatusPending, limit,
+	).Scan(&messages)
+	return messages
+}
+
+func (repo *MailMessageRepositoryImpl) Save(message *model.MailMessage) {
+	repo.db.Save(message)
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type OrganizationRepository interface {
+	FindByUUID(uuid string) *model.Organization
+	FindByMemberIdentityID(identityID int64) []*model.Organization
+	FindMembers(organizationID int64) []*model.OrganizationMember
+	FindMember(organizationID, identityID int64) *model.OrganizationMember
+	Save(organization *model.Organization)
+	SaveMember(member *model.OrganizationMember)
+	DeleteMember(member *model.OrganizationMember)
+}
+
+type OrganizationRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewOrganizationRepository(db *gorm.DB) (OrganizationRepository, error) {
+	return &OrganizationRepositoryImpl{db}, nil
+}
+
+func (repo *OrganizationRepositoryImpl) FindByUUID(uuid string) *model.Organization {
+	var organization model.Organization
+	repo.db.Where(&model.Organization{UUID: uuid}).First(&organization)
+	if organization.ID == 0 {
+		return nil
+	}
+	return &organization
+}
+
+func (repo *OrganizationRepositoryImpl) FindByMemberIdentityID(identityID int64) []*model.Organization {
+	var organizations []*model.Organization
+	repo.db.
+		Joins("join organization_members on organization_members.organization_id = organizations.id").
+		Where("organization_members.identity_id = ?", identityID).
+		Order("organizations.id").
+		Find(&organizations)
+	return organizations
+}
+
+func (repo *OrganizationRepositoryImpl) FindMembers(organizationID int64) []*model.OrganizationMember {
+	var members []*model.OrganizationMember
+	repo.db.Where(&model.OrganizationMember{OrganizationID: organizationID}).Preload("Identity").Order("id").Find(&members)
+	return members
+}
+
+func (repo *OrganizationRepositoryImpl) FindMember(organizationID, identityID int64) *model.OrganizationMember {
+	var member model.OrganizationMember
+	repo.db.Where(&model.OrganizationMember{OrganizationID: organizationID, IdentityID: identityID}).Preload("Identity").First(&member)
+	if member.ID == 0 {
+		return nil
+	}
+	return &member
+}
+
+func (repo *OrganizationRepositoryImpl) Save(organization *model.Organization) {
+	repo.db.Save(organization)
+}
+
+// SaveMember saves the member without its identity, which may be a stale copy.
+func (repo *OrganizationRepositoryImpl) SaveMember(member *model.OrganizationMember) {
+	repo.db.Set("gorm:association_autoupdate", false).Save(member)
+}
+
+func (repo *OrganizationRepositoryImpl) DeleteMember(member *model.OrganizationMember) {
+	repo.db.Delete(member)
+}
@@ -7,7 +7,14 @@ import (
 )
 
 type StorageBucketRepository interface {
+	FindByID(id int64) *model.StorageBucket
 	FindByName(name string) *model.StorageBucket
+	FindByIdentityID(identityID int64) []*model.StorageBucket
+	FindPurging(limit int) []*model.StorageBucket
+	FindAfterID(id int64, limit int) []*model.StorageBucket
+	ExistsByName(name string) bool
+	Save(bucket *model.StorageBucket)
+	Delete(bucket *model.StorageBucket)
 }
 
 type StorageBucketRepositoryImpl struct {
@@ -18,11 +25,62 @@ func NewStorageBucketRepository(db *gorm.DB) (StorageBucketRepository, error) {
 	return &StorageBucketRepositoryImpl{db: db}, nil
 }
 
+// FindByID finds the bucket, including ones being purged.
+func (repo StorageBucketRepositoryImpl) FindByID(id int64) *model.StorageBucket {
+	var bucket model.StorageBucket
+	repo.db.Where("id = ?", id).First(&bucket)
+	if bucket.ID == 0 {
+		return nil
+	}
+	return &bucket
+}
+
+// FindByName finds the bucket, except for ones being purged.
 func (repo StorageBucketRepositoryImpl) FindByName(name string) *model.StorageBucket {
 	var bucket model.StorageBucket
-	repo.db.Where(&model.StorageBucket{Name: name}).First(&bucket)
+	repo.db.Where(&model.StorageBucket{Name: name}).Where("purge_requested_at is null").Preload("Owner").First(&bucket)
 	if bucket.ID == 0 {
 		return nil
 	}
 	return &bucket
 }
+
+// FindByIdentityID finds buckets owned by the identity, or by organizations which the identity belongs to.
+func (repo StorageBucketRepositoryImpl) FindByIdentityID(identityID int64) []*model.StorageBucket {
+	var buckets []*model.StorageBucket
+	repo.db.
+		Where("owner_id = ? or organization_id in (select organization_id from organization_members where identity_id = ?)", identityID, identityID).
+		Where("purge_requested_at is null").
+		Order("id").
+		Find(&buckets)
+	return buckets
+}
+
+func (repo StorageBucketRepositoryImpl) FindPurging(limit int) []*model.StorageBucket {
+	var buckets []*model.StorageBucket
+	repo.db.Where("purge_requested_at is not null").Order("purge_requested_at").Limit(limit).Find(&buckets)
+	return buckets
+}
+
+// FindAfterID finds buckets in the order of IDs, except for ones being purged.
+func (repo StorageBucketRepositoryImpl) FindAfterID(id int64, limit int) []*model.StorageBucket {
+	var buckets []*model.StorageBucket
+	repo.db.Where("id > ? and purge_requested_at is null", id).Order("id").Limit(limit).Find(&buckets)
+	return buckets
+}
+
+// ExistsByName returns whether the name is taken, including buckets being purged.
+func (repo StorageBucketRepositoryImpl) ExistsByName(name string) bool {
+	var count int
+	repo.db.Model(&model.StorageBucket{}).Where(&model.StorageBucket{Name: name}).Count(&count)
+	return count > 0
+}
+
+// Save saves the bucket without its owner, which may be a stale copy.
+func (repo StorageBucketRepositoryImpl) Save(bucket *model.StorageBucket) {
+	repo.db.Set("gorm:association_autoupdate", false).Save(bucket)
+}
+
+func (repo StorageBucketRepositoryImpl) Delete(bucket *model.StorageBucket) {
+	repo.db.Delete(bucket)
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type StorageObjectRepository interface {
+	Find(bucketID int64, key string) *model.StorageObject
+	FindByKeys(bucketID int64, keys []string) []*model.StorageObject
+	FindByPrefix(bucketID int64, prefix string, limit int) []*model.StorageObject
+	List(bucketID int64, prefix, delimiter, after string, limit int) []*model.StorageListEntry
+	Save(object *model.StorageObject)
+	CreateIfMissing(object *model.StorageObject) bool
+	DeleteByKeys(bucketID int64, keys []string)
+}
+
+type StorageObjectRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewStorageObjectRepository(db *gorm.DB) (StorageObjectRepository, error) {
+	return &StorageObjectRepositoryImpl{db: db}, nil
+}
+
+func (repo StorageObjectRepositoryImpl) Find(bucketID int64, key string) *model.StorageObject {
+	var object model.StorageObject
+	repo.db.Where(&model.StorageObject{BucketID: bucketID, Key: key}).First(&object)
+	if object.ID == 0 {
+		return nil
+	}
+	return &object
+}
+
+func (repo StorageObjectRepositoryImpl) Save(object *model.StorageObject) {
+	repo.db.Save(object)
+}
+
+// CreateIfMissing creates the object unless the key already exists, and returns whether it is created. The object is
+// not saved over the existing one, which may be newer.
+func (repo StorageObjectRepositoryImpl) CreateIfMissing(object *model.StorageObject) bool {
+	result := repo.db.Exec(`
+		insert into storage_objects (bucket_id, key, content_type, size, etag, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?, ?)
+		on conflict (bucket_id, key) do nothing`,
+		object.BucketID, object.Key, object.ContentType, object.Size, object.ETag, object.CreatedAt, object.UpdatedAt,
+	)
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+func (repo StorageObjectRepositoryImpl) FindByKeys(bucketID int64, keys []string) []*model.StorageObject {
+	var objects []*model.StorageObject
+	repo.db.Where("bucket_id = ? and key in (?)", bucketID, keys).Find(&objects)
+	return objects
+}
+
+// FindByPrefix returns objects whose keys start with the prefix, in the order of keys.
+func (repo StorageObjectRepositoryImpl) FindByPrefix(bucketID int64, prefix string, limit int) []*model.StorageObject {
+	var objects []*model.StorageObject
+	repo.db.Where("bucket_id = ? and key like ?", bucketID, escapeLike(prefix)+"%").Order("key").Limit(limit).Find(&objects)
+	return objects
+}
+
+func (repo StorageObjectRepositoryImpl) DeleteByKeys(bucketID int64, keys []string) {
+	repo.db.Where("bucket_id = ? and key in (?)", bucketID, keys).Delete(&model.StorageObject{})
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// List returns objects whose keys start with the prefix, and come after `after` in byte order. If the delimiter is
+// given, keys containing it after the prefix are grouped into a common prefix, ending with the delimiter.
+func (repo StorageObjectRepositoryImpl) List(bucketID int64, prefix, delimiter, after string, limit int) []*model.StorageListEntry {
+	rows, err := repo.db.Raw(`
+		select entry, bool_or(is_prefix) from (
+		  select case when pos > 0 then substr(key, 1, char_length(?::text) + pos - 1 + char_length(?::text)) else key end as entry,
+		         pos > 0 as is_prefix
+		  from (
+		    select key, case when ?::text = '' then 0 else strpos(substr(key, char_length(?::text) + 1), ?::text) end as pos
+		    from storage_objects where bucket_id = ? and key like ? and key collate "C" > ?::text
+		  ) keys
+		) entries
+		where entry collate "C" > ?::text
+		group by entry
+		order by entry collate "C"
+		limit ?`,
+		prefix, delimiter, delimiter, prefix, delimiter, bucketID, escapeLike(prefix)+"%", after, after, limit,
+	).Rows()
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var entries []*model.StorageListEntry
+	var keys []string
+	for rows.Next() {
+		var entry string
+		var isPrefix bool
+		if err := rows.Scan(&entry, &isPrefix); err != nil {
+			continue
+		}
+		if isPrefix {
+			entries = append(entries, &model.StorageListEntry{Prefix: entry})
+		} else {
+			entries = append(entries, &model.StorageListEntry{Object: &model.StorageObject{Key: entry}})
+			keys = append(keys, entry)
+		}
+	}
+	if len(keys) == 0 {
+		return entries
+	}
+
+	objects := map[string]*model.StorageObject{}
+	for _, object := range repo.FindByKeys(bucketID, keys) {
+		objects[object.Key] = object
+	}
+	for _, entry := range entries {
+		if entry.Object != nil && objects[entry.Object.Key] != nil {
+			entry.Object = objects[entry.Object.Key]
+		}
+	}
+	return entries
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type StorageUploadRepository interface {
+	FindByUUID(uuid string) *model.StorageUpload
+	FindExpired(now time.Time, limit int) []*model.StorageUpload
+	Save(upload *model.StorageUpload)
+	Delete(upload *model.StorageUpload)
+}
+
+type StorageUploadRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewStorageUploadRepository(db *gorm.DB) (StorageUploadRepository, error) {
+	return &StorageUploadRepositoryImpl{db: db}, nil
+}
+
+func (repo StorageUploadRepositoryImpl) FindByUUID(uuid string) *model.StorageUpload {
+	var upload model.StorageUpload
+	repo.db.Where(&model.StorageUpload{UUID: uuid}).First(&upload)
+	if upload.ID == 0 {
+		return nil
+	}
+	return &upload
+}
+
+func (repo StorageUploadRepositoryImpl) FindExpired(now time.Time, limit int) []*model.StorageUpload {
+	var uploads []*model.StorageUpload
+	repo.db.Where("expire_at < ?", now).Order("expire_at").Limit(limit).Find(&uploads)
+	return uploads
+}
+
+func (repo StorageUploadRepositoryImpl) Save(upload *model.StorageUpload) {
+	repo.db.Save(upload)
+}
+
+func (repo StorageUploadRepositoryImpl) Delete(upload *model.StorageUpload) {
+	repo.db.Delete(upload)
+}
@@ -40,6 +40,7 @@ func (repo *UserAccountRepositoryImpl) FindByProviderId(provider, providerId str
 	return &account
 }
 
+// Save saves the account without its identity, which may be a stale copy.
 func (repo *UserAccountRepositoryImpl) Save(account *model.UserAccount) {
-	repo.db.Save(account)
+	repo.db.Set("gorm:association_autoupdate", false).Save(account)
 }
@@ -1,12 +1,19 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/hellodhlyn/luppiter/model"
 	"github.com/jinzhu/gorm"
 )
 
 type UserIdentityRepository interface {
+	FindByUUID(uuid string) *model.UserIdentity
+	FindByEmail(email string) *model.UserIdentity
+	Search(query string, offset, limit int) []*model.UserIdentity
 	Save(identity *model.UserIdentity)
+	UpgradeGuest(identity *model.UserIdentity, username, email string) bool
+	DeleteGuestsCreatedBefore(t time.Time) int64
 }
 
 type UserIdentityRepositoryImpl struct {
@@ -17,6 +24,77 @@ func NewUserIdentityRepository(db *gorm.DB) (UserIdentityRepository, error) {
 	return &UserIdentityRepositoryImpl{db}, nil
 }
 
+func (repo *UserIdentityRepositoryImpl) FindByUUID(uuid string) *model.UserIdentity {
+	var identity model.UserIdentity
+	repo.db.Where(&model.UserIdentity{UUID: uuid}).First(&identity)
+	if identity.ID == 0 {
+		return nil
+	}
+	return &identity
+}
+
 func (repo *UserIdentityRepositoryImpl) Save(identity *model.UserIdentity) {
 	repo.db.Save(identity)
 }
+
+// UpgradeGuest makes the guest a full identity with the username and the email. Only those columns are updated, so that
+// changes made meanwhile such as suspensions are kept. It returns false if the identity is not a guest.
+func (repo *UserIdentityRepositoryImpl) UpgradeGuest(identity *model.UserIdentity, username, email string) bool {
+	result := repo.db.Model(&model.UserIdentity{}).Where("id = ? and is_guest", identity.ID).
+		Updates(map[string]interface{}{"is_guest": false, "username": username, "email": email})
+	if result.RowsAffected == 0 {
+		return false
+	}
+	identity.IsGuest = false
+	identity.Username = username
+	identity.Email = email
+	return true
+}
+
+func (repo *UserIdentityRepositoryImpl) FindByEmail(email string) *model.UserIdentity {
+	var identity model.UserIdentity
+	repo.db.Where("lower(email) = lower(?)", email).Order("id").First(&identity)
+	if identity.ID == 0 {
+		return nil
+	}
+	return &identity
+}
+
+// Search finds identities whose UUID, username or email contains the query. An empty query matches every identity.
+func (repo *UserIdentityRepositoryImpl) Search(query string, offset, limit int) []*model.UserIdentity {
+	var identities []*model.UserIdentity
+	tx := repo.db
+	if query != "" {
+		pattern := "%" + query + "%"
+		tx = tx.Where("uuid like ? or username ilike ? or email ilike ?", pattern, pattern, pattern)
+	}
+	tx.Order("id").Offset(offset).Limit(limit).Find(&identities)
+	return identities
+}
+
+// DeleteGuestsCreatedBefore deletes guest identities created before the time, with their access tokens, consent
+// grants and organization memberships. Guests which own applications or storage buckets are kept.
+func (repo *UserIdentityRepositoryImpl) DeleteGuestsCreatedBefore(t time.Time) int64 {
+	guests := repo.db.Table("user_identities").Select("id").
+		Where("is_guest and created_at < ?", t).
+		Where("not exists (select 1 from applications where applications.owner_id = user_identities.id)").
+		Where("not exists (select 1 from storage_buckets where storage_buckets.owner_id = user_identities.id)").
+		SubQuery()
+
+	var deleted int64
+	_ = repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("identity_id in ?", guests).Delete(&model.AccessToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("identity_id in ?", guests).Delete(&model.ConsentGrant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("identity_id in ?", guests).Delete(&model.OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id in ?", guests).Delete(&model.UserIdentity{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted
+}
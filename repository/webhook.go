@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/hellodhlyn/luppiter/envelope"
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+type WebhookRepository interface {
+	FindByID(id int64) *model.Webhook
+	FindByUUID(uuid string) *model.Webhook
+	FindByApplicationID(applicationID int64) []*model.Webhook
+	Save(webhook *model.Webhook) error
+	Delete(webhook *model.Webhook)
+	DeleteByApplicationID(applicationID int64)
+}
+
+// WebhookRepositoryImpl stores signing secrets of webhooks encrypted by the keyring.
+type WebhookRepositoryImpl struct {
+	db      *gorm.DB
+	keyring *envelope.Keyring
+}
+
+func NewWebhookRepository(db *gorm.DB, keyring *envelope.Keyring) (WebhookRepository, error) {
+	return &WebhookRepositoryImpl{db, keyring}, nil
+}
+
+func (repo *WebhookRepositoryImpl) FindByID(id int64) *model.Webhook {
+	var webhook model.Webhook
+	repo.db.First(&webhook, id)
+	if webhook.ID == 0 {
+		return nil
+	}
+	return repo.decrypt(&webhook)
+}
+
+func (repo *WebhookRepositoryImpl) FindByUUID(uuid string) *model.Webhook {
+	var webhook model.Webhook
+	repo.db.Where(&model.Webhook{UUID: uuid}).First(&webhook)
+	if webhook.ID == 0 {
+		return nil
+	}
+	return repo.decrypt(&webhook)
+}
+
+func (repo *WebhookRepositoryImpl) FindByApplicationID(applicationID int64) []*model.Webhook {
+	var webhooks []*model.Webhook
+	repo.db.Where(&model.Webhook{ApplicationID: applicationID}).Order("id").Find(&webhooks)
+
+	decrypted := make([]*model.Webhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		if repo.decrypt(webhook) != nil {
+			decrypted = append(decrypted, webhook)
+		}
+	}
+	return decrypted
+}
+
+// Save encrypts the signing secret and saves the webhook. The webhook is not saved if the encryption fails.
+func (repo *WebhookRepositoryImpl) Save(webhook *model.Webhook) error {
+	signingSecret := webhook.SigningSecret
+	encrypted, err := repo.keyring.Encrypt(signingSecret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the webhook signing secret: %w", err)
+	}
+
+	webhook.SigningSecret = encrypted
+	err = repo.db.Save(webhook).Error
+	webhook.SigningSecret = signingSecret
+	return err
+}
+
+// Delete deletes the webhook with its delivery log.
+func (repo *WebhookRepositoryImpl) Delete(webhook *model.Webhook) {
+	_ = repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(&model.WebhookDelivery{WebhookID: webhook.ID}).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+}
+
+func (repo *WebhookRepositoryImpl) DeleteByApplicationID(applicationID int64) {
+	webhooks := repo.db.Table("webhooks").Select("id").Where("application_id = ?", applicationID).SubQuery()
+	_ = repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id in ?", webhooks).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where(&model.Webhook{ApplicationID: applicationID}).Delete(&model.Webhook{}).Error
+	})
+}
+
+func (repo *WebhookRepositoryImpl) decrypt(webhook *model.Webhook) *model.Webhook {
+	signingSecret, err := repo.keyring.Decrypt(webhook.SigningSecret)
+	if err != nil {
+		log.Printf("failed to decrypt the webhook signing secret %d: %v", webhook.ID, err)
+		return nil
+	}
+	webhook.SigningSecret = signingSecret
+	return webhook
+}
+
+type WebhookDeliveryRepository interface {
+	FindByUUID(uuid string) *model.WebhookDelivery
+	FindByWebhookID(webhookID int64, offset, limit int) []*model.WebhookDelivery
+	ClaimDue(limit int, lease time.Duration) []*model.WebhookDelivery
+	Save(delivery *model.WebhookDelivery)
+}
+
+type WebhookDeliveryRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewWebhookDeliveryRepository(db *gorm.DB) (WebhookDeliveryRepository, error) {
+	return &WebhookDeliveryRepositoryImpl{db}, nil
+}
+
+func (repo *WebhookDeliveryRepositoryImpl) FindByUUID(uuid string) *model.WebhookDelivery {
+	var delivery model.WebhookDelivery
+	repo.db.Where(&model.WebhookDelivery{UUID: uuid}).First(&delivery)
+	if delivery.ID == 0 {
+		return nil
+	}
+	return &delivery
+}
+
+// FindByWebhookID returns deliveries of the webhook, from the latest one.
+func (repo *WebhookDeliveryRepositoryImpl) FindByWebhookID(webhookID int64, offset, limit int) []*model.WebhookDelivery {
+	var deliveries []*model.WebhookDelivery
+	repo.db.Where(&model.WebhookDelivery{WebhookID: webhookID}).Order("id desc").Offset(offset).Limit(limit).Find(&deliveries)
+	return deliveries
+}
+
+// ClaimDue finds pending deliveries, and postpones their next attempt by the lease like `MailMessageRepository`.
+func (repo *WebhookDeliveryRepositoryImpl) ClaimDue(limit int, lease time.Duration) []*model.WebhookDelivery {
+	var deliveries []*model.WebhookDelivery
+	repo.db.Raw(`
+		update webhook_deliveries set next_attempt_at = ? where id in (
+			select id from webhook_deliveries
+			where status = ? and next_attempt_at <= current_timestamp
+			order by next_attempt_at limit ?
+			for update skip locked
+		) returning *`,
+		time.Now().Add(lease), model.WebhookDeliveryStatusPending, limit,
+	).Scan(&deliveries)
+	return deliveries
+}
+
+func (repo *WebhookDeliveryRepositoryImpl) Save(delivery *model.WebhookDelivery) {
+	repo.db.Save(delivery)
+}
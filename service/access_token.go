@@ -12,19 +12,35 @@ import (
 )
 
 type AccessTokenService interface {
-	CreateAccessToken(identity *model.UserIdentity, app *model.Application) (*model.AccessToken, error)
+	CreateAccessToken(identity *model.UserIdentity, app *model.Application, scopes []string) (*model.AccessToken, error)
 	ActivateAccessToken(activationToken string) (*model.AccessToken, error)
+	RefreshAccessToken(token *model.AccessToken) (*model.AccessToken, error)
 }
 
 type AccessTokenServiceImpl struct {
-	repo repository.AccessTokenRepository
+	repo        repository.AccessTokenRepository
+	secretRepo  repository.ApplicationSecretRepository
+	consentRepo repository.ConsentGrantRepository
+	statsSvc    StatsService
 }
 
-func NewAccessTokenService(repo repository.AccessTokenRepository) (AccessTokenService, error) {
-	return &AccessTokenServiceImpl{repo}, nil
+func NewAccessTokenService(
+	repo repository.AccessTokenRepository,
+	secretRepo repository.ApplicationSecretRepository,
+	consentRepo repository.ConsentGrantRepository,
+	statsSvc StatsService,
+) (AccessTokenService, error) {
+	return &AccessTokenServiceImpl{repo, secretRepo, consentRepo, statsSvc}, nil
 }
 
-func (svc *AccessTokenServiceImpl) CreateAccessToken(identity *model.UserIdentity, app *model.Application) (*model.AccessToken, error) {
+// CreateAccessToken issues an access token for the scopes, to be activated by the application. Default scopes are used
+// if none is given.
+func (svc *AccessTokenServiceImpl) CreateAccessToken(identity *model.UserIdentity, app *model.Application, scopes []string) (*model.AccessToken, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+
 	token := &model.AccessToken{
 		IdentityID:    identity.ID,
 		Identity:      *identity,
@@ -34,38 +50,107 @@ func (svc *AccessTokenServiceImpl) CreateAccessToken(identity *model.UserIdentit
 		SecretKey:     secureRandomString(20),
 		ActivationKey: secureRandomString(20),
 		Activated:     false,
+		Scopes:        scopes,
 	}
 
-	svc.repo.Save(token)
+	if err := svc.repo.Save(token); err != nil {
+		return nil, err
+	}
+	svc.statsSvc.RecordSignIn(app.ID, identity.ID)
 	return token, nil
 }
 
 func (svc *AccessTokenServiceImpl) ActivateAccessToken(activationToken string) (*model.AccessToken, error) {
-	token, _ := jwt.Parse(activationToken, nil)
-	activationKey := token.Claims.(jwt.MapClaims)["activationKey"].(string)
+	claims := jwt.MapClaims{}
+	token, _, err := new(jwt.Parser).ParseUnverified(activationToken, claims)
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+	activationKey, _ := claims["activationKey"].(string)
 	accessToken := svc.repo.FindByActivationKey(activationKey)
 	if accessToken == nil {
 		return nil, errors.New("access token not found")
 	}
 
-	token, err := jwt.Parse(activationToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+	// The token may be signed by any active secret of the application. If `kid` is given, only that secret is used.
+	kid, _ := token.Header["kid"].(string)
+	verified := false
+	for _, secret := range svc.activeSecrets(accessToken.ApplicationID, kid) {
+		if verifyHMAC(activationToken, secret.SecretKey) {
+			verified = true
+			break
 		}
-		return []byte(accessToken.Application.SecretKey), nil
-	})
-	if err != nil {
+	}
+	if !verified {
 		return nil, errors.New("invalid token")
 	}
+	if err := checkIdentityStatus(&accessToken.Identity); err != nil {
+		return nil, err
+	}
+	if grant := svc.consentRepo.Find(accessToken.IdentityID, accessToken.ApplicationID); grant == nil || !grant.Covers(accessToken.Scopes) {
+		return nil, ErrConsentRequired
+	}
 
-	expireAt := time.Now().AddDate(0, 0, 7)
+	now := time.Now()
+	expireAt := accessToken.Application.TokenPolicy.ExpireAt(now, now)
 	accessToken.Activated = true
+	accessToken.ActivatedAt = &now
+	accessToken.LastUsedAt = &now
 	accessToken.ExpireAt = &expireAt
-	svc.repo.Save(accessToken)
+	if err := svc.repo.Save(accessToken); err != nil {
+		return nil, err
+	}
+	svc.statsSvc.RecordActivation(accessToken.ApplicationID, accessToken.IdentityID)
 
 	return accessToken, nil
 }
 
+// RefreshAccessToken extends the token by the TTL from now, if the application allows refreshes. Tokens can not be
+// extended beyond the maximum session lifetime.
+func (svc *AccessTokenServiceImpl) RefreshAccessToken(token *model.AccessToken) (*model.AccessToken, error) {
+	policy := token.Application.TokenPolicy
+	if !policy.RefreshAllowed {
+		return nil, fmt.Errorf("%w: the application does not allow refreshing tokens", ErrPermissionDenied)
+	}
+
+	now := time.Now()
+	activatedAt := now
+	if token.ActivatedAt != nil {
+		activatedAt = *token.ActivatedAt
+	}
+	svc.repo.UpdateExpiry(token, policy.ExpireAt(activatedAt, now), now)
+	return token, nil
+}
+
+func (svc *AccessTokenServiceImpl) activeSecrets(applicationID int64, kid string) []*model.ApplicationSecret {
+	var secrets []*model.ApplicationSecret
+	if kid != "" {
+		if secret := svc.secretRepo.FindByKID(applicationID, kid); secret != nil {
+			secrets = append(secrets, secret)
+		}
+	} else {
+		secrets = svc.secretRepo.FindByApplicationID(applicationID)
+	}
+
+	active := make([]*model.ApplicationSecret, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret.IsActive() {
+			active = append(active, secret)
+		}
+	}
+	return active
+}
+
+func verifyHMAC(tokenString, secretKey string) bool {
+	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(secretKey), nil
+	})
+	return err == nil
+}
+
 func secureRandomString(l int) string {
 	bytes := make([]byte, l)
 	_, _ = rand.Read(bytes)
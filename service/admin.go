@@ -0,0 +1,197 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+// AdminService provides administrative operations for system administrators. Every operation checks that the actor
+// is an administrator, and records the action in the audit log.
+type AdminService interface {
+	SearchIdentities(actor *model.UserIdentity, query string, offset, limit int) ([]*model.UserIdentity, error)
+	SetIdentityStatus(actor *model.UserIdentity, identityUUID, status, reason string, until *time.Time) (*model.UserIdentity, error)
+	RevokeAccessTokens(actor *model.UserIdentity, identityUUID string) error
+	TransferApplication(actor *model.UserIdentity, appUUID, ownerUUID, orgUUID string) (*model.Application, error)
+	TransferBucket(actor *model.UserIdentity, bucketName, ownerUUID, orgUUID string) (*model.StorageBucket, error)
+	GetBucket(actor *model.UserIdentity, bucketName string) (*model.StorageBucket, error)
+	ListAuditLogs(actor *model.UserIdentity, offset, limit int) ([]*model.AdminAuditLog, error)
+}
+
+type AdminServiceImpl struct {
+	identityRepo repository.UserIdentityRepository
+	tokenRepo    repository.AccessTokenRepository
+	appRepo      repository.ApplicationRepository
+	bucketRepo   repository.StorageBucketRepository
+	orgRepo      repository.OrganizationRepository
+	auditRepo    repository.AdminAuditLogRepository
+	webhookSvc   WebhookService
+}
+
+func NewAdminService(
+	identityRepo repository.UserIdentityRepository,
+	tokenRepo repository.AccessTokenRepository,
+	appRepo repository.ApplicationRepository,
+	bucketRepo repository.StorageBucketRepository,
+	orgRepo repository.OrganizationRepository,
+	auditRepo repository.AdminAuditLogRepository,
+	webhookSvc WebhookService,
+) (AdminService, error) {
+	return &AdminServiceImpl{identityRepo, tokenRepo, appRepo, bucketRepo, orgRepo, auditRepo, webhookSvc}, nil
+}
+
+func (svc *AdminServiceImpl) SearchIdentities(actor *model.UserIdentity, query string, offset, limit int) ([]*model.UserIdentity, error) {
+	if !actor.IsAdmin {
+		return nil, ErrPermissionDenied
+	}
+	return svc.identityRepo.Search(query, offset, limit), nil
+}
+
+// SetIdentityStatus changes the status of an identity. The reason and the end time are only kept for suspensions.
+// Applications authorized by the identity are notified when it is going to be deleted.
+func (svc *AdminServiceImpl) SetIdentityStatus(actor *model.UserIdentity, identityUUID, status, reason string, until *time.Time) (*model.UserIdentity, error) {
+	if !actor.IsAdmin {
+		return nil, ErrPermissionDenied
+	}
+	if !model.IsValidIdentityStatus(status) {
+		return nil, invalidArgument("unknown status")
+	}
+
+	identity := svc.identityRepo.FindByUUID(identityUUID)
+	if identity == nil {
+		return nil, fmt.Errorf("%w: no such identity", ErrNotFound)
+	}
+
+	previous := identity.EffectiveStatus()
+	identity.Status = status
+	identity.SuspensionReason = ""
+	identity.SuspendedUntil = nil
+	if status == model.IdentityStatusSuspended {
+		identity.SuspensionReason = reason
+		identity.SuspendedUntil = until
+	}
+	svc.identityRepo.Save(identity)
+	if status == model.IdentityStatusPendingDeletion && previous != status {
+		svc.webhookSvc.NotifyAuthorizedApps(model.WebhookEventIdentityDeleted, identity)
+	}
+
+	detail := status
+	if reason != "" {
+		detail += ", reason: " + reason
+	}
+	svc.audit(actor, model.AdminActionSetIdentityStatus, identity.UUID, detail)
+	return identity, nil
+}
+
+func (svc *AdminServiceImpl) RevokeAccessTokens(actor *model.UserIdentity, identityUUID string) error {
+	if !actor.IsAdmin {
+		return ErrPermissionDenied
+	}
+
+	identity := svc.identityRepo.FindByUUID(identityUUID)
+	if identity == nil {
+		return fmt.Errorf("%w: no such identity", ErrNotFound)
+	}
+
+	svc.tokenRepo.DeleteByIdentityID(identity.ID)
+	svc.audit(actor, model.AdminActionRevokeTokens, identity.UUID, "")
+	return nil
+}
+
+func (svc *AdminServiceImpl) TransferApplication(actor *model.UserIdentity, appUUID, ownerUUID, orgUUID string) (*model.Application, error) {
+	if !actor.IsAdmin {
+		return nil, ErrPermissionDenied
+	}
+
+	app := svc.appRepo.FindByUUID(appUUID)
+	if app == nil {
+		return nil, fmt.Errorf("%w: no such application", ErrNotFound)
+	}
+	owner, orgID, err := svc.findNewOwner(ownerUUID, orgUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := fmt.Sprintf("owner: %d -> %d, organization: %s -> %s", app.OwnerID, owner.ID, formatID(app.OrganizationID), formatID(orgID))
+	app.OwnerID = int(owner.ID)
+	app.Owner = *owner
+	app.OrganizationID = orgID
+	svc.appRepo.Save(app)
+
+	svc.audit(actor, model.AdminActionTransferApplication, app.UUID, detail)
+	return app, nil
+}
+
+func (svc *AdminServiceImpl) TransferBucket(actor *model.UserIdentity, bucketName, ownerUUID, orgUUID string) (*model.StorageBucket, error) {
+	if !actor.IsAdmin {
+		return nil, ErrPermissionDenied
+	}
+
+	bucket := svc.bucketRepo.FindByName(bucketName)
+	if bucket == nil {
+		return nil, fmt.Errorf("%w: no such bucket", ErrNotFound)
+	}
+	owner, orgID, err := svc.findNewOwner(ownerUUID, orgUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := fmt.Sprintf("owner: %d -> %d, organization: %s -> %s", bucket.OwnerID, owner.ID, formatID(bucket.OrganizationID), formatID(orgID))
+	bucket.OwnerID = owner.ID
+	bucket.Owner = *owner
+	bucket.OrganizationID = orgID
+	svc.bucketRepo.Save(bucket)
+
+	svc.audit(actor, model.AdminActionTransferBucket, bucket.Name, detail)
+	return bucket, nil
+}
+
+func (svc *AdminServiceImpl) GetBucket(actor *model.UserIdentity, bucketName string) (*model.StorageBucket, error) {
+	if !actor.IsAdmin {
+		return nil, ErrPermissionDenied
+	}
+
+	bucket := svc.bucketRepo.FindByName(bucketName)
+	if bucket == nil {
+		return nil, fmt.Errorf("%w: no such bucket", ErrNotFound)
+	}
+
+	svc.audit(actor, model.AdminActionViewBucket, bucket.Name, "")
+	return bucket, nil
+}
+
+func (svc *AdminServiceImpl) ListAuditLogs(actor *model.UserIdentity, offset, limit int) ([]*model.AdminAuditLog, error) {
+	if !actor.IsAdmin {
+		return nil, ErrPermissionDenied
+	}
+	return svc.auditRepo.FindAll(offset, limit), nil
+}
+
+func (svc *AdminServiceImpl) findNewOwner(ownerUUID, orgUUID string) (*model.UserIdentity, *int64, error) {
+	owner := svc.identityRepo.FindByUUID(ownerUUID)
+	if owner == nil {
+		return nil, nil, fmt.Errorf("%w: no such identity", ErrNotFound)
+	}
+	if orgUUID == "" {
+		return owner, nil, nil
+	}
+
+	org := svc.orgRepo.FindByUUID(orgUUID)
+	if org == nil {
+		return nil, nil, fmt.Errorf("%w: no such organization", ErrNotFound)
+	}
+	return owner, &org.ID, nil
+}
+
+func (svc *AdminServiceImpl) audit(actor *model.UserIdentity, action, target, detail string) {
+	svc.auditRepo.Save(&model.AdminAuditLog{ActorID: actor.ID, Action: action, Target: target, Detail: detail})
+}
+
+func formatID(id *int64) string {
+	if id == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d", *id)
+}
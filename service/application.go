@@ -1,22 +1,307 @@
 package service
 
 import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
 	"github.com/hellodhlyn/luppiter/model"
 	"github.com/hellodhlyn/luppiter/repository"
 )
 
+var (
+	ErrApplicationNameTaken = conflict("the application name is already taken")
+	ErrLastActiveSecret     = invalidArgument("the last active secret can not be retired")
+)
+
 type ApplicationService interface {
 	FindByUUID(uuid string) *model.Application
+	HasPermission(identity *model.UserIdentity, app *model.Application, perm Permission) bool
+
+	CreateApplication(owner *model.UserIdentity, name, orgUUID string) (*model.Application, error)
+	ListApplications(identity *model.UserIdentity) []*model.Application
+	UpdateApplication(identity *model.UserIdentity, app *model.Application, name string, allowedOrigins, redirectURIs []string, policy *model.TokenPolicy) error
+	DeleteApplication(identity *model.UserIdentity, app *model.Application) error
+
+	ListSecrets(identity *model.UserIdentity, app *model.Application) ([]*model.ApplicationSecret, error)
+	CreateSecret(identity *model.UserIdentity, app *model.Application, label string, expireAt *time.Time) (*model.ApplicationSecret, error)
+	UpdateSecret(identity *model.UserIdentity, app *model.Application, kid, label string, expireAt *time.Time) (*model.ApplicationSecret, error)
+	RetireSecret(identity *model.UserIdentity, app *model.Application, kid string) error
 }
 
 type ApplicationServiceImpl struct {
-	repo repository.ApplicationRepository
+	repo       repository.ApplicationRepository
+	secretRepo repository.ApplicationSecretRepository
+	orgRepo    repository.OrganizationRepository
 }
 
-func NewApplicationService(repo repository.ApplicationRepository) (ApplicationService, error) {
-	return &ApplicationServiceImpl{repo}, nil
+func NewApplicationService(
+	repo repository.ApplicationRepository,
+	secretRepo repository.ApplicationSecretRepository,
+	orgRepo repository.OrganizationRepository,
+) (ApplicationService, error) {
+	return &ApplicationServiceImpl{repo, secretRepo, orgRepo}, nil
 }
 
 func (svc *ApplicationServiceImpl) FindByUUID(uuid string) *model.Application {
 	return svc.repo.FindByUUID(uuid)
 }
+
+func (svc *ApplicationServiceImpl) HasPermission(identity *model.UserIdentity, app *model.Application, perm Permission) bool {
+	return isPermitted(svc.orgRepo, identity, int64(app.OwnerID), app.OrganizationID, perm)
+}
+
+// CreateApplication creates an application with its first secret key. If the organization is given, the owner should be
+// an admin of it.
+func (svc *ApplicationServiceImpl) CreateApplication(owner *model.UserIdentity, name, orgUUID string) (*model.Application, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, invalidArgument("name is required")
+	}
+	if svc.repo.FindByName(name) != nil {
+		return nil, ErrApplicationNameTaken
+	}
+
+	app := &model.Application{
+		UUID:        uuid.New().String(),
+		Name:        name,
+		OwnerID:     int(owner.ID),
+		TokenPolicy: model.TokenPolicy{TokenTTL: model.DefaultTokenTTL},
+	}
+	if orgUUID != "" {
+		org := svc.orgRepo.FindByUUID(orgUUID)
+		if org == nil {
+			return nil, fmt.Errorf("%w: no such organization", ErrNotFound)
+		}
+		if !isPermitted(svc.orgRepo, owner, 0, &org.ID, PermissionManage) {
+			return nil, ErrPermissionDenied
+		}
+		app.OrganizationID = &org.ID
+	}
+	svc.repo.Save(app)
+
+	secret := newApplicationSecret("default", nil)
+	secret.ApplicationID = app.ID
+	if err := svc.secretRepo.Save(secret); err != nil {
+		return nil, err
+	}
+	app.Secrets = []model.ApplicationSecret{*secret}
+	return app, nil
+}
+
+func (svc *ApplicationServiceImpl) ListApplications(identity *model.UserIdentity) []*model.Application {
+	return svc.repo.FindByIdentityID(identity.ID)
+}
+
+// UpdateApplication updates the application. Allowed origins, redirect URIs and the token policy are left as they are
+// if nil.
+func (svc *ApplicationServiceImpl) UpdateApplication(identity *model.UserIdentity, app *model.Application, name string, allowedOrigins, redirectURIs []string, policy *model.TokenPolicy) error {
+	if !svc.HasPermission(identity, app, PermissionManage) {
+		return ErrPermissionDenied
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return invalidArgument("name is required")
+	}
+	if existing := svc.repo.FindByName(name); existing != nil && existing.ID != app.ID {
+		return ErrApplicationNameTaken
+	}
+
+	if allowedOrigins != nil {
+		origins := make([]string, 0, len(allowedOrigins))
+		for _, origin := range allowedOrigins {
+			normalized, err := normalizeOrigin(origin)
+			if err != nil {
+				return err
+			}
+			origins = append(origins, normalized)
+		}
+		app.AllowedOrigins = origins
+	}
+	if redirectURIs != nil {
+		for _, uri := range redirectURIs {
+			if err := validateRedirectURI(uri); err != nil {
+				return err
+			}
+		}
+		app.RedirectURIs = redirectURIs
+	}
+	if policy != nil {
+		if err := validateTokenPolicy(policy); err != nil {
+			return err
+		}
+		app.TokenPolicy = *policy
+	}
+
+	app.Name = name
+	svc.repo.Save(app)
+	return nil
+}
+
+// DeleteApplication deletes the application with everything issued for it, such as access tokens and secrets. Cached
+// access tokens are evicted by the notifications of the deletion.
+func (svc *ApplicationServiceImpl) DeleteApplication(identity *model.UserIdentity, app *model.Application) error {
+	if !svc.HasPermission(identity, app, PermissionManage) {
+		return ErrPermissionDenied
+	}
+
+	return svc.repo.Delete(app)
+}
+
+func (svc *ApplicationServiceImpl) ListSecrets(identity *model.UserIdentity, app *model.Application) ([]*model.ApplicationSecret, error) {
+	if !svc.HasPermission(identity, app, PermissionManage) {
+		return nil, ErrPermissionDenied
+	}
+	return svc.secretRepo.FindByApplicationID(app.ID), nil
+}
+
+// CreateSecret adds a secret to the application. Existing secrets stay active, so that clients can move to the new
+// secret before the old one is retired.
+func (svc *ApplicationServiceImpl) CreateSecret(identity *model.UserIdentity, app *model.Application, label string, expireAt *time.Time) (*model.ApplicationSecret, error) {
+	if !svc.HasPermission(identity, app, PermissionManage) {
+		return nil, ErrPermissionDenied
+	}
+	if expireAt != nil && expireAt.Before(time.Now()) {
+		return nil, invalidArgument("expireAt should be in the future")
+	}
+
+	secret := newApplicationSecret(label, expireAt)
+	secret.ApplicationID = app.ID
+	if err := svc.secretRepo.Save(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (svc *ApplicationServiceImpl) UpdateSecret(identity *model.UserIdentity, app *model.Application, kid, label string, expireAt *time.Time) (*model.ApplicationSecret, error) {
+	if !svc.HasPermission(identity, app, PermissionManage) {
+		return nil, ErrPermissionDenied
+	}
+	if expireAt != nil && expireAt.Before(time.Now()) {
+		return nil, invalidArgument("expireAt should be in the future")
+	}
+
+	secret := svc.secretRepo.FindByKID(app.ID, kid)
+	if secret == nil {
+		return nil, fmt.Errorf("%w: no such secret", ErrNotFound)
+	}
+
+	secret.Label = label
+	secret.ExpireAt = expireAt
+	if err := svc.secretRepo.Save(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// RetireSecret deactivates the secret immediately. The last active secret can not be retired.
+func (svc *ApplicationServiceImpl) RetireSecret(identity *model.UserIdentity, app *model.Application, kid string) error {
+	if !svc.HasPermission(identity, app, PermissionManage) {
+		return ErrPermissionDenied
+	}
+
+	var target *model.ApplicationSecret
+	active := 0
+	for _, secret := range svc.secretRepo.FindByApplicationID(app.ID) {
+		if secret.KID == kid {
+			target = secret
+		}
+		if secret.IsActive() {
+			active++
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("%w: no such secret", ErrNotFound)
+	}
+	if !target.IsActive() {
+		return nil
+	}
+	if active <= 1 {
+		return ErrLastActiveSecret
+	}
+
+	now := time.Now()
+	target.RetiredAt = &now
+	return svc.secretRepo.Save(target)
+}
+
+func newApplicationSecret(label string, expireAt *time.Time) *model.ApplicationSecret {
+	return &model.ApplicationSecret{
+		KID:       secureRandomString(8),
+		Label:     label,
+		SecretKey: secureRandomString(20),
+		ExpireAt:  expireAt,
+	}
+}
+
+// normalizeOrigin validates an origin such as `https://example.com:8080`, and returns it in the form of `Origin`
+// headers sent by browsers.
+func normalizeOrigin(origin string) (string, error) {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", invalidArgument(fmt.Sprintf("invalid origin: %s", origin))
+	}
+	return fmt.Sprintf("%s://%s", u.Scheme, strings.ToLower(u.Host)), nil
+}
+
+// customSchemePattern matches custom schemes of native apps, which should be reverse DNS names such as
+// `com.example.app`.
+var customSchemePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*(\.[a-z][a-z0-9-]*)+$`)
+
+// validateRedirectURI checks that a redirect URI is absolute and has no fragment. It should be https, or http only for
+// loopback hosts. Custom schemes in reverse DNS names are allowed for native apps.
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" || u.User != nil {
+		return invalidArgument(fmt.Sprintf("invalid redirect URI: %s", uri))
+	}
+
+	var allowed bool
+	switch u.Scheme {
+	case "https":
+		allowed = u.Host != ""
+	case "http":
+		allowed = u.Host != "" && isLoopbackHost(u.Hostname())
+	case "javascript", "data", "vbscript", "file":
+		allowed = false
+	default:
+		allowed = customSchemePattern.MatchString(u.Scheme)
+	}
+	if !allowed {
+		return invalidArgument(fmt.Sprintf("unsupported redirect URI: %s", uri))
+	}
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+const (
+	minTokenDuration = 60
+	maxTokenTTL      = 365 * 24 * 60 * 60
+)
+
+func validateTokenPolicy(policy *model.TokenPolicy) error {
+	if policy.TokenTTL < minTokenDuration || policy.TokenTTL > maxTokenTTL {
+		return invalidArgument("token ttl should be between 1 minute and 365 days")
+	}
+	if policy.MaxSessionLifetime != 0 && policy.MaxSessionLifetime < minTokenDuration {
+		return invalidArgument("max session lifetime should be 0 or at least 1 minute")
+	}
+	if policy.IdleTimeout != 0 && policy.IdleTimeout < minTokenDuration {
+		return invalidArgument("idle timeout should be 0 or at least 1 minute")
+	}
+	return nil
+}
@@ -4,25 +4,40 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/hellodhlyn/luppiter/model"
 	"github.com/hellodhlyn/luppiter/repository"
 )
 
+// lastUsedPrecision is how often the last used time of an access token is updated, to save writes on every request.
+const lastUsedPrecision = time.Minute
+
 type AuthenticationService interface {
 	Authenticate(*http.Request) (*model.UserIdentity, error)
+	AuthenticateToken(*http.Request) (*model.AccessToken, error)
 }
 
 type AuthenticationServiceImpl struct {
 	tokenRepo repository.AccessTokenRepository
+	statsSvc  StatsService
 }
 
-func NewAuthenticationService(tokenRepo repository.AccessTokenRepository) (AuthenticationService, error) {
-	return &AuthenticationServiceImpl{tokenRepo}, nil
+func NewAuthenticationService(tokenRepo repository.AccessTokenRepository, statsSvc StatsService) (AuthenticationService, error) {
+	return &AuthenticationServiceImpl{tokenRepo, statsSvc}, nil
 }
 
 func (svc *AuthenticationServiceImpl) Authenticate(r *http.Request) (*model.UserIdentity, error) {
+	accessToken, err := svc.AuthenticateToken(r)
+	if err != nil {
+		return nil, err
+	}
+	return &accessToken.Identity, nil
+}
+
+// AuthenticateToken returns the access token of the request, if it is valid under the token policy of its application.
+func (svc *AuthenticationServiceImpl) AuthenticateToken(r *http.Request) (*model.AccessToken, error) {
 	authorization := r.Header.Get("Authorization")
 	splits := strings.Split(authorization, " ")
 	if len(splits) != 2 {
@@ -30,25 +45,61 @@ func (svc *AuthenticationServiceImpl) Authenticate(r *http.Request) (*model.User
 	}
 	jwtString := splits[len(splits)-1]
 
-	token, _ := jwt.Parse(jwtString, nil)
-	accessKey := token.Claims.(jwt.MapClaims)["accessKey"].(string)
-	accessToken := svc.tokenRepo.FindByAccessKey(accessKey)
-	if accessToken == nil {
-		return nil, errors.New("invalid access key")
-	}
-
-	token, err := jwt.Parse(jwtString, func(jwtToken *jwt.Token) (interface{}, error) {
+	// Find the access token while verifying the signature, so that the JWT is parsed only once.
+	var accessToken *model.AccessToken
+	_, err := jwt.Parse(jwtString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
+		accessKey, _ := token.Claims.(jwt.MapClaims)["accessKey"].(string)
+		accessToken = svc.tokenRepo.FindByAccessKey(accessKey)
+		if accessToken == nil {
+			return nil, errors.New("invalid access key")
+		}
 		return []byte(accessToken.SecretKey), nil
 	})
+	if accessToken == nil {
+		return nil, errors.New("invalid access key")
+	}
 	if err != nil {
 		return nil, errors.New("invalid signature")
 	}
-	if accessToken.HasExpired() {
+	if !accessToken.Activated {
+		return nil, errors.New("access token not activated")
+	}
+	now := time.Now()
+	if accessToken.HasExpired() || hasPolicyExpired(accessToken, now) {
 		return nil, errors.New("access token expired")
 	}
+	if err := checkIdentityStatus(&accessToken.Identity); err != nil {
+		return nil, err
+	}
 
-	return &accessToken.Identity, nil
+	if accessToken.LastUsedAt == nil || now.Sub(*accessToken.LastUsedAt) >= lastUsedPrecision {
+		svc.tokenRepo.UpdateLastUsedAt(accessToken, now)
+	}
+	svc.statsSvc.RecordRequest(accessToken.ApplicationID, accessToken.IdentityID)
+	return accessToken, nil
+}
+
+// hasPolicyExpired checks the token by the current policy of the application, so that tightened policies apply to
+// tokens issued before.
+func hasPolicyExpired(token *model.AccessToken, now time.Time) bool {
+	policy := token.Application.TokenPolicy
+	if token.ActivatedAt != nil {
+		if sessionEnd := policy.SessionExpireAt(*token.ActivatedAt); sessionEnd != nil && sessionEnd.Before(now) {
+			return true
+		}
+	}
+
+	lastUsedAt := token.LastUsedAt
+	if lastUsedAt == nil {
+		lastUsedAt = token.ActivatedAt
+	}
+	if lastUsedAt != nil {
+		if idleEnd := policy.IdleExpireAt(*lastUsedAt); idleEnd != nil && idleEnd.Before(now) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+// queryLatency is the round trip of a query to the database. FindByAccessKey runs three queries, for the token and
+// its two preloaded associations.
+const queryLatency = 100 * time.Microsecond
+
+// slowAccessTokenRepository finds a token as the database would, taking the time of three queries.
+type slowAccessTokenRepository struct {
+	repository.AccessTokenRepository
+	token *model.AccessToken
+}
+
+func (repo *slowAccessTokenRepository) FindByAccessKey(accessKey string) *model.AccessToken {
+	time.Sleep(3 * queryLatency)
+	if accessKey != repo.token.AccessKey {
+		return nil
+	}
+	token := *repo.token
+	return &token
+}
+
+func (repo *slowAccessTokenRepository) UpdateLastUsedAt(token *model.AccessToken, t time.Time) {
+	time.Sleep(queryLatency)
+	token.LastUsedAt = &t
+}
+
+func newBenchmarkRequest(b *testing.B, token *model.AccessToken) *http.Request {
+	jwtString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"accessKey": token.AccessKey}).
+		SignedString([]byte(token.SecretKey))
+	if err != nil {
+		b.Fatal(err)
+	}
+	r, _ := http.NewRequest(http.MethodGet, "/storage/bucket/key", nil)
+	r.Header.Set("Authorization", "Bearer "+jwtString)
+	return r
+}
+
+func BenchmarkAuthenticate(b *testing.B) {
+	now := time.Now()
+	expireAt := now.Add(time.Hour)
+	token := &model.AccessToken{
+		IdentityID:    1,
+		Identity:      model.UserIdentity{Status: model.IdentityStatusActive},
+		ApplicationID: 1,
+		AccessKey:     secureRandomString(20),
+		SecretKey:     secureRandomString(20),
+		Activated:     true,
+		ExpireAt:      &expireAt,
+		ActivatedAt:   &now,
+		LastUsedAt:    &now,
+	}
+	statsSvc, _ := NewStatsService(nil, nil)
+	uncached := &slowAccessTokenRepository{token: token}
+	cached, _ := repository.NewCachedAccessTokenRepository(uncached, nil, 1000, time.Minute)
+
+	benchmarks := []struct {
+		name string
+		repo repository.AccessTokenRepository
+	}{
+		{"uncached", uncached},
+		{"cached", cached},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			svc, _ := NewAuthenticationService(bm.repo, statsSvc)
+			r := newBenchmarkRequest(b, token)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := svc.Authenticate(r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
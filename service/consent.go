@@ -0,0 +1,190 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+// consentRequestTTL is how long the user can take on the consent page after signing in.
+const consentRequestTTL = 30 * time.Minute
+
+var (
+	// ErrConsentRequired is returned on activation, when the user has not agreed to the scopes the token was issued for.
+	ErrConsentRequired = fmt.Errorf("%w: consent required", ErrPermissionDenied)
+	// ErrConsoleSessionRequired is returned when consent requests are accessed by a token of other than the console.
+	ErrConsoleSessionRequired = fmt.Errorf("%w: consent can be given only on the Luppiter console", ErrPermissionDenied)
+	ErrNoSuchConsentRequest   = fmt.Errorf("%w: no such consent request", ErrNotFound)
+)
+
+// ConsentPrompt is a consent request of a signed-in access token, with the URL of the consent page on the console.
+type ConsentPrompt struct {
+	Token *model.AccessToken
+	URL   string
+}
+
+// ConsentService records which scopes of user data each identity agreed to share with applications. Users are asked
+// for consent only when an application requests scopes beyond the ones already granted.
+//
+// Users agree on the consent page of the Luppiter console, signed in to the console itself. Applications can not give
+// consent on behalf of users, since they do not hold access tokens of the console.
+type ConsentService interface {
+	MissingScopes(identity *model.UserIdentity, app *model.Application, scopes []string) []string
+	Grant(identity *model.UserIdentity, app *model.Application, scopes []string) *model.ConsentGrant
+	RequestConsent(token *model.AccessToken) (*ConsentPrompt, error)
+	FindConsentRequest(session *model.AccessToken, consentKey string) (*model.AccessToken, error)
+	ApproveConsent(session *model.AccessToken, consentKey string, scopes []string) (*model.ConsentGrant, error)
+	ListGrants(identity *model.UserIdentity) []*model.ConsentGrant
+	Revoke(identity *model.UserIdentity, appUUID string) error
+}
+
+type ConsentServiceImpl struct {
+	repo         repository.ConsentGrantRepository
+	tokenRepo    repository.AccessTokenRepository
+	appRepo      repository.ApplicationRepository
+	webhookSvc   WebhookService
+	consoleAppID string
+	consentURL   string
+}
+
+// NewConsentService creates the service. consoleAppID is the UUID of the Luppiter console application, whose access
+// tokens can give consent. Consent can not be given if it is empty.
+func NewConsentService(
+	repo repository.ConsentGrantRepository,
+	tokenRepo repository.AccessTokenRepository,
+	appRepo repository.ApplicationRepository,
+	webhookSvc WebhookService,
+	consoleAppID string,
+	consentURL string,
+) (ConsentService, error) {
+	return &ConsentServiceImpl{repo, tokenRepo, appRepo, webhookSvc, consoleAppID, consentURL}, nil
+}
+
+func (svc *ConsentServiceImpl) MissingScopes(identity *model.UserIdentity, app *model.Application, scopes []string) []string {
+	grant := svc.repo.Find(identity.ID, app.ID)
+	if grant == nil {
+		return scopes
+	}
+	return grant.MissingScopes(scopes)
+}
+
+// Grant adds the scopes to the identity's grant for the application. Scopes granted before are kept.
+func (svc *ConsentServiceImpl) Grant(identity *model.UserIdentity, app *model.Application, scopes []string) *model.ConsentGrant {
+	grant := svc.repo.Find(identity.ID, app.ID)
+	if grant == nil {
+		grant = &model.ConsentGrant{IdentityID: identity.ID, ApplicationID: app.ID}
+	}
+
+	missing := grant.MissingScopes(scopes)
+	if len(missing) > 0 || grant.ID == 0 {
+		now := time.Now()
+		grant.Scopes = append(grant.Scopes, missing...)
+		grant.GrantedAt = &now
+		svc.repo.Save(grant)
+	}
+	grant.Application = *app
+	return grant
+}
+
+// RequestConsent starts a consent request for the scopes of the signed-in token which are not granted yet. It returns
+// nil if every scope is granted. The console itself does not ask for consent.
+func (svc *ConsentServiceImpl) RequestConsent(token *model.AccessToken) (*ConsentPrompt, error) {
+	if svc.consoleAppID != "" && token.Application.UUID == svc.consoleAppID {
+		svc.Grant(&token.Identity, &token.Application, token.Scopes)
+		return nil, nil
+	}
+
+	missing := svc.MissingScopes(&token.Identity, &token.Application, token.Scopes)
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	svc.tokenRepo.UpdateConsent(token, secureRandomString(20), missing)
+	link, err := url.Parse(svc.consentURL)
+	if err != nil {
+		return nil, err
+	}
+	query := link.Query()
+	query.Set("key", token.ConsentKey)
+	link.RawQuery = query.Encode()
+	return &ConsentPrompt{Token: token, URL: link.String()}, nil
+}
+
+// FindConsentRequest returns the signed-in token which waits for consent of the user of the console session.
+func (svc *ConsentServiceImpl) FindConsentRequest(session *model.AccessToken, consentKey string) (*model.AccessToken, error) {
+	if svc.consoleAppID == "" || session.Application.UUID != svc.consoleAppID {
+		return nil, ErrConsoleSessionRequired
+	}
+
+	token := svc.tokenRepo.FindByConsentKey(consentKey)
+	if token == nil || token.Activated || token.IdentityID != session.IdentityID ||
+		token.CreatedAt == nil || token.CreatedAt.Add(consentRequestTTL).Before(time.Now()) {
+		return nil, ErrNoSuchConsentRequest
+	}
+	return token, nil
+}
+
+// ApproveConsent grants the scopes which the user approved on the consent page. Only the scopes shown to the user,
+// which are the ones missing on sign-in, can be approved.
+func (svc *ConsentServiceImpl) ApproveConsent(session *model.AccessToken, consentKey string, scopes []string) (*model.ConsentGrant, error) {
+	token, err := svc.FindConsentRequest(session, consentKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(scopes) == 0 {
+		return nil, invalidArgument("scopes are required")
+	}
+	requested := &model.ConsentGrant{Scopes: token.ConsentScopes}
+	if missing := requested.MissingScopes(scopes); len(missing) > 0 {
+		return nil, invalidArgument(fmt.Sprintf("scopes are not requested: %s", strings.Join(missing, ", ")))
+	}
+
+	grant := svc.Grant(&token.Identity, &token.Application, scopes)
+	svc.tokenRepo.UpdateConsent(token, "", []string{})
+	return grant, nil
+}
+
+func (svc *ConsentServiceImpl) ListGrants(identity *model.UserIdentity) []*model.ConsentGrant {
+	return svc.repo.FindByIdentityID(identity.ID)
+}
+
+// Revoke deletes the grant for the application, and revokes every access token issued to it for the identity. The
+// application is notified by webhooks.
+func (svc *ConsentServiceImpl) Revoke(identity *model.UserIdentity, appUUID string) error {
+	app := svc.appRepo.FindByUUID(appUUID)
+	if app == nil {
+		return fmt.Errorf("%w: no such application", ErrNotFound)
+	}
+	grant := svc.repo.Find(identity.ID, app.ID)
+	if grant == nil {
+		return fmt.Errorf("%w: the application is not authorized", ErrNotFound)
+	}
+
+	svc.tokenRepo.DeleteByIdentityAndApplication(identity.ID, app.ID)
+	svc.repo.Delete(grant)
+	svc.webhookSvc.NotifyApplication(model.WebhookEventConsentRevoked, identity, app)
+	return nil
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return model.DefaultScopes, nil
+	}
+
+	normalized := make([]string, 0, len(scopes))
+	seen := map[string]bool{}
+	for _, scope := range scopes {
+		if !model.IsValidScope(scope) {
+			return nil, invalidArgument("unknown scope " + scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+// Errors returned by services. Controllers translate them into HTTP status codes with `errors.Is`.
+var (
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrConflict         = errors.New("conflict")
+	ErrNotFound         = errors.New("not found")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrTooLarge         = errors.New("too large")
+)
+
+func invalidArgument(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidArgument, reason)
+}
+
+func conflict(reason string) error {
+	return fmt.Errorf("%w: %s", ErrConflict, reason)
+}
+
+// IdentityStatusError is returned when an identity can not be used because it is not active.
+type IdentityStatusError struct {
+	Status string
+	Reason string
+	Until  *time.Time
+}
+
+func (e *IdentityStatusError) Error() string {
+	return "identity is " + strings.ReplaceAll(e.Status, "_", " ")
+}
+
+// Code is a machine-readable error code, such as `identity_suspended`.
+func (e *IdentityStatusError) Code() string {
+	return "identity_" + e.Status
+}
+
+func (e *IdentityStatusError) Unwrap() error {
+	return ErrPermissionDenied
+}
+
+func checkIdentityStatus(identity *model.UserIdentity) error {
+	switch status := identity.EffectiveStatus(); status {
+	case model.IdentityStatusActive:
+		return nil
+	case model.IdentityStatusSuspended:
+		return &IdentityStatusError{Status: status, Reason: identity.SuspensionReason, Until: identity.SuspendedUntil}
+	default:
+		return &IdentityStatusError{Status: status}
+	}
+}
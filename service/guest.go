@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+var ErrAccountAlreadyLinked = conflict("the account is already linked to another identity")
+
+// GuestService manages anonymous identities, which let users try applications before signing in. A guest becomes a
+// full identity when an account of a provider is linked, and unclaimed guests are deleted after the retention period.
+type GuestService interface {
+	CreateGuest() (*model.UserIdentity, error)
+	CleanUpGuests() int64
+	RunCleanup(interval time.Duration)
+}
+
+type GuestServiceImpl struct {
+	identityRepo repository.UserIdentityRepository
+	retention    time.Duration
+}
+
+func NewGuestService(identityRepo repository.UserIdentityRepository, retention time.Duration) (GuestService, error) {
+	return &GuestServiceImpl{identityRepo, retention}, nil
+}
+
+func (svc *GuestServiceImpl) CreateGuest() (*model.UserIdentity, error) {
+	identity := &model.UserIdentity{
+		UUID:     uuid.New().String(),
+		Username: fmt.Sprintf("guest-%s", secureRandomString(8)),
+		Status:   model.IdentityStatusActive,
+		IsGuest:  true,
+	}
+	svc.identityRepo.Save(identity)
+	return identity, nil
+}
+
+// CleanUpGuests deletes guests created before the retention period, and returns the number of deleted guests.
+func (svc *GuestServiceImpl) CleanUpGuests() int64 {
+	return svc.identityRepo.DeleteGuestsCreatedBefore(time.Now().Add(-svc.retention))
+}
+
+func (svc *GuestServiceImpl) RunCleanup(interval time.Duration) {
+	for range time.Tick(interval) {
+		if deleted := svc.CleanUpGuests(); deleted > 0 {
+			log.Printf("deleted %d unclaimed guests", deleted)
+		}
+	}
+}
+
+// upgradeGuest makes the guest a full identity. The identity may be a cached one, so it is not saved as a whole.
+func upgradeGuest(identityRepo repository.UserIdentityRepository, webhookSvc WebhookService, identity *model.UserIdentity, username, email string) {
+	if !identity.IsGuest {
+		return
+	}
+
+	emailChanged := identity.Email != email
+	if !identityRepo.UpgradeGuest(identity, username, email) {
+		return
+	}
+	if emailChanged {
+		webhookSvc.NotifyAuthorizedApps(model.WebhookEventIdentityEmailChanged, identity)
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hellodhlyn/luppiter/mailer"
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+var (
+	ErrInvalidMagicLink   = invalidArgument("invalid or expired link")
+	ErrInvalidRedirectURI = invalidArgument("the redirect URI is not registered for the application")
+)
+
+// MagicLinkService signs users in by single-use links sent to their email addresses.
+type MagicLinkService interface {
+	SendMagicLink(email string, app *model.Application, redirectURI, locale string) error
+	FindOrCreateByMagicLink(token string, app *model.Application) (*model.UserAccount, error)
+	LinkByMagicLink(identity *model.UserIdentity, token string, app *model.Application) (*model.UserAccount, error)
+}
+
+type MagicLinkServiceImpl struct {
+	linkRepo     repository.MagicLinkRepository
+	accountRepo  repository.UserAccountRepository
+	identityRepo repository.UserIdentityRepository
+	mailSvc      MailService
+	webhookSvc   WebhookService
+	linkURL      string
+}
+
+func NewMagicLinkService(
+	linkRepo repository.MagicLinkRepository,
+	accountRepo repository.UserAccountRepository,
+	identityRepo repository.UserIdentityRepository,
+	mailSvc MailService,
+	webhookSvc WebhookService,
+	linkURL string,
+) (MagicLinkService, error) {
+	return &MagicLinkServiceImpl{linkRepo, accountRepo, identityRepo, mailSvc, webhookSvc, linkURL}, nil
+}
+
+// SendMagicLink mails a sign-in link to the email. The link opens the redirect URI, which should be registered for the
+// application, or the default page if not given.
+func (svc *MagicLinkServiceImpl) SendMagicLink(email string, app *model.Application, redirectURI, locale string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		return invalidArgument("invalid email")
+	}
+	if locale != "" && !mailer.IsValidLocale(locale) {
+		return invalidArgument("invalid locale")
+	}
+	if redirectURI == "" {
+		redirectURI = svc.linkURL
+	} else if !app.IsRedirectURIAllowed(redirectURI) || validateRedirectURI(redirectURI) != nil {
+		return ErrInvalidRedirectURI
+	}
+	email = strings.ToLower(address.Address)
+
+	token := secureRandomString(20)
+	expireAt := time.Now().Add(magicLinkTTL)
+	svc.linkRepo.Save(&model.MagicLink{
+		TokenHash:     hashToken(token),
+		Email:         email,
+		ApplicationID: app.ID,
+		ExpireAt:      &expireAt,
+	})
+
+	link, err := url.Parse(redirectURI)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	query.Set("appId", app.UUID)
+	link.RawQuery = query.Encode()
+
+	return svc.mailSvc.Enqueue(email, "magic_link", locale, map[string]interface{}{
+		"Application": app.Name,
+		"Link":        link.String(),
+		"ExpireIn":    int(magicLinkTTL.Minutes()),
+	})
+}
+
+// FindOrCreateByMagicLink consumes the link, and finds the account of the email. If there is no such account, it
+// links a new account to the identity with the same email, or creates a new identity.
+func (svc *MagicLinkServiceImpl) FindOrCreateByMagicLink(token string, app *model.Application) (*model.UserAccount, error) {
+	link := svc.linkRepo.Consume(hashToken(token), app.ID)
+	if link == nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	account := svc.accountRepo.FindByProviderId(providerEmail, link.Email)
+	if account == nil {
+		identity := svc.identityRepo.FindByEmail(link.Email)
+		if identity == nil {
+			identity = &model.UserIdentity{
+				UUID:     uuid.New().String(),
+				Username: usernameFromEmail(link.Email),
+				Email:    link.Email,
+				Status:   model.IdentityStatusActive,
+			}
+			svc.identityRepo.Save(identity)
+		}
+
+		account = &model.UserAccount{Provider: providerEmail, ProviderID: link.Email, IdentityID: identity.ID, Identity: *identity}
+		svc.accountRepo.Save(account)
+	}
+
+	if err := checkIdentityStatus(&account.Identity); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// LinkByMagicLink consumes the link, and links the email to the identity. A guest identity is upgraded to a full
+// identity in place.
+func (svc *MagicLinkServiceImpl) LinkByMagicLink(identity *model.UserIdentity, token string, app *model.Application) (*model.UserAccount, error) {
+	link := svc.linkRepo.Consume(hashToken(token), app.ID)
+	if link == nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	if account := svc.accountRepo.FindByProviderId(providerEmail, link.Email); account != nil {
+		if account.IdentityID != identity.ID {
+			return nil, ErrAccountAlreadyLinked
+		}
+		return account, nil
+	}
+
+	upgradeGuest(svc.identityRepo, svc.webhookSvc, identity, usernameFromEmail(link.Email), link.Email)
+
+	account := &model.UserAccount{Provider: providerEmail, ProviderID: link.Email, IdentityID: identity.ID, Identity: *identity}
+	svc.accountRepo.Save(account)
+	return account, nil
+}
+
+func hashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// usernameFromEmail makes a username from the local part of an email, with a random suffix since usernames are unique.
+func usernameFromEmail(email string) string {
+	return fmt.Sprintf("%s-%s", strings.SplitN(email, "@", 2)[0], secureRandomString(2))
+}
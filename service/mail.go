@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/mailer"
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+const (
+	mailBatchSize      = 20
+	mailLease          = 5 * time.Minute
+	mailMaxAttempts    = 8
+	mailInitialBackoff = time.Minute
+	mailMaxBackoff     = 6 * time.Hour
+)
+
+// MailService renders messages from templates and sends them through a queue persisted in the database, so that
+// messages are retried when the mail server is not available.
+type MailService interface {
+	Enqueue(to, templateName, locale string, data interface{}) error
+	ProcessQueue() int
+	RunQueue(interval time.Duration)
+}
+
+type MailServiceImpl struct {
+	repo      repository.MailMessageRepository
+	mailer    mailer.Mailer
+	templates *mailer.Templates
+	from      string
+}
+
+func NewMailService(repo repository.MailMessageRepository, m mailer.Mailer, templates *mailer.Templates, from string) (MailService, error) {
+	if err := (&mailer.Message{From: from}).Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %v", from, err)
+	}
+	return &MailServiceImpl{repo, m, templates, from}, nil
+}
+
+func (svc *MailServiceImpl) Enqueue(to, templateName, locale string, data interface{}) error {
+	if err := (&mailer.Message{To: to}).Validate(); err != nil {
+		return invalidArgument(err.Error())
+	}
+	msg, err := svc.templates.Render(templateName, locale, data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	svc.repo.Save(&model.MailMessage{
+		Recipient:     to,
+		Subject:       msg.Subject,
+		TextBody:      msg.TextBody,
+		HTMLBody:      msg.HTMLBody,
+		Status:        model.MailStatusPending,
+		NextAttemptAt: &now,
+	})
+	return nil
+}
+
+// ProcessQueue sends a batch of due messages, and returns the number of messages sent.
+func (svc *MailServiceImpl) ProcessQueue() int {
+	sent := 0
+	for _, message := range svc.repo.ClaimDue(mailBatchSize, mailLease) {
+		message.Attempts++
+		err := svc.mailer.Send(&mailer.Message{
+			From:     svc.from,
+			To:       message.Recipient,
+			Subject:  message.Subject,
+			TextBody: message.TextBody,
+			HTMLBody: message.HTMLBody,
+		})
+
+		now := time.Now()
+		if err == nil {
+			message.Status = model.MailStatusSent
+			message.SentAt = &now
+			message.LastError = ""
+			sent++
+		} else if message.Attempts >= mailMaxAttempts {
+			message.Status = model.MailStatusFailed
+			message.LastError = err.Error()
+		} else {
+			next := now.Add(backoff(message.Attempts, mailInitialBackoff, mailMaxBackoff))
+			message.NextAttemptAt = &next
+			message.LastError = err.Error()
+		}
+		svc.repo.Save(message)
+	}
+	return sent
+}
+
+func (svc *MailServiceImpl) RunQueue(interval time.Duration) {
+	for range time.Tick(interval) {
+		if sent := svc.ProcessQueue(); sent > 0 {
+			log.Printf("sent %d mail messages", sent)
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt, which doubles on every failed attempt.
+func backoff(attempts int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+var (
+	ErrInvalidRole = invalidArgument("unknown role")
+	ErrLastOwner   = invalidArgument("an organization must have at least one owner")
+)
+
+type OrganizationService interface {
+	CreateOrganization(owner *model.UserIdentity, name string) (*model.Organization, error)
+	FindByUUID(uuid string) *model.Organization
+	ListOrganizations(identity *model.UserIdentity) []*model.Organization
+	ListMembers(identity *model.UserIdentity, org *model.Organization) ([]*model.OrganizationMember, error)
+	SetMemberRole(actor *model.UserIdentity, org *model.Organization, identityUUID, role string) (*model.OrganizationMember, error)
+	RemoveMember(actor *model.UserIdentity, org *model.Organization, identityUUID string) error
+}
+
+type OrganizationServiceImpl struct {
+	repo         repository.OrganizationRepository
+	identityRepo repository.UserIdentityRepository
+}
+
+func NewOrganizationService(repo repository.OrganizationRepository, identityRepo repository.UserIdentityRepository) (OrganizationService, error) {
+	return &OrganizationServiceImpl{repo, identityRepo}, nil
+}
+
+func (svc *OrganizationServiceImpl) CreateOrganization(owner *model.UserIdentity, name string) (*model.Organization, error) {
+	if name == "" {
+		return nil, invalidArgument("name is required")
+	}
+
+	org := &model.Organization{UUID: uuid.New().String(), Name: name}
+	svc.repo.Save(org)
+	svc.repo.SaveMember(&model.OrganizationMember{OrganizationID: org.ID, IdentityID: owner.ID, Role: model.OrganizationRoleOwner})
+	return org, nil
+}
+
+func (svc *OrganizationServiceImpl) FindByUUID(uuid string) *model.Organization {
+	return svc.repo.FindByUUID(uuid)
+}
+
+func (svc *OrganizationServiceImpl) ListOrganizations(identity *model.UserIdentity) []*model.Organization {
+	return svc.repo.FindByMemberIdentityID(identity.ID)
+}
+
+func (svc *OrganizationServiceImpl) ListMembers(identity *model.UserIdentity, org *model.Organization) ([]*model.OrganizationMember, error) {
+	if svc.repo.FindMember(org.ID, identity.ID) == nil {
+		return nil, ErrPermissionDenied
+	}
+	return svc.repo.FindMembers(org.ID), nil
+}
+
+// SetMemberRole adds an identity to the organization, or changes the role of an existing member. Admins can manage
+// members, but only owners can grant or take away the owner role.
+func (svc *OrganizationServiceImpl) SetMemberRole(actor *model.UserIdentity, org *model.Organization, identityUUID, role string) (*model.OrganizationMember, error) {
+	if !model.IsValidOrganizationRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	actorRole := svc.roleOf(org, actor.ID)
+	if actorRole != model.OrganizationRoleOwner && actorRole != model.OrganizationRoleAdmin {
+		return nil, ErrPermissionDenied
+	}
+
+	identity := svc.identityRepo.FindByUUID(identityUUID)
+	if identity == nil {
+		return nil, fmt.Errorf("%w: no such identity", ErrNotFound)
+	}
+
+	member := svc.repo.FindMember(org.ID, identity.ID)
+	if member == nil {
+		member = &model.OrganizationMember{OrganizationID: org.ID, IdentityID: identity.ID, Identity: *identity}
+	}
+	if role == model.OrganizationRoleOwner || member.Role == model.OrganizationRoleOwner {
+		if actorRole != model.OrganizationRoleOwner {
+			return nil, ErrPermissionDenied
+		}
+		if member.Role == model.OrganizationRoleOwner && role != model.OrganizationRoleOwner && svc.countOwners(org) <= 1 {
+			return nil, ErrLastOwner
+		}
+	}
+
+	member.Role = role
+	svc.repo.SaveMember(member)
+	return member, nil
+}
+
+// RemoveMember removes an identity from the organization. Members can always leave by themselves.
+func (svc *OrganizationServiceImpl) RemoveMember(actor *model.UserIdentity, org *model.Organization, identityUUID string) error {
+	identity := svc.identityRepo.FindByUUID(identityUUID)
+	if identity == nil {
+		return fmt.Errorf("%w: no such identity", ErrNotFound)
+	}
+	member := svc.repo.FindMember(org.ID, identity.ID)
+	if member == nil {
+		return fmt.Errorf("%w: not a member", ErrNotFound)
+	}
+
+	if actor.ID != identity.ID {
+		actorRole := svc.roleOf(org, actor.ID)
+		if actorRole != model.OrganizationRoleOwner && actorRole != model.OrganizationRoleAdmin {
+			return ErrPermissionDenied
+		}
+		if member.Role == model.OrganizationRoleOwner && actorRole != model.OrganizationRoleOwner {
+			return ErrPermissionDenied
+		}
+	}
+	if member.Role == model.OrganizationRoleOwner && svc.countOwners(org) <= 1 {
+		return ErrLastOwner
+	}
+
+	svc.repo.DeleteMember(member)
+	return nil
+}
+
+func (svc *OrganizationServiceImpl) roleOf(org *model.Organization, identityID int64) string {
+	member := svc.repo.FindMember(org.ID, identityID)
+	if member == nil {
+		return ""
+	}
+	return member.Role
+}
+
+func (svc *OrganizationServiceImpl) countOwners(org *model.Organization) int {
+	count := 0
+	for _, member := range svc.repo.FindMembers(org.ID) {
+		if member.Role == model.OrganizationRoleOwner {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/lib/pq"
+
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+// OriginService checks origins of CORS requests against allowed origins of every application. The origins are kept in
+// memory, and refreshed when applications are changed.
+type OriginService interface {
+	IsAllowedOrigin(origin string) bool
+	Refresh()
+	Watch(listener *pq.Listener)
+}
+
+type OriginServiceImpl struct {
+	appRepo repository.ApplicationRepository
+	static  []string
+
+	mu      sync.RWMutex
+	origins map[string]bool
+}
+
+// NewOriginService creates an origin service. Static origins are always allowed besides ones of applications, and
+// `*` allows every origin.
+func NewOriginService(appRepo repository.ApplicationRepository, static []string) (OriginService, error) {
+	svc := &OriginServiceImpl{appRepo: appRepo, static: static}
+	svc.Refresh()
+	return svc, nil
+}
+
+func (svc *OriginServiceImpl) IsAllowedOrigin(origin string) bool {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	return svc.origins["*"] || svc.origins[origin]
+}
+
+func (svc *OriginServiceImpl) Refresh() {
+	origins := map[string]bool{}
+	for _, origin := range svc.static {
+		if origin != "" {
+			origins[origin] = true
+		}
+	}
+	for _, origin := range svc.appRepo.FindAllowedOrigins() {
+		origins[origin] = true
+	}
+
+	svc.mu.Lock()
+	svc.origins = origins
+	svc.mu.Unlock()
+}
+
+// Watch refreshes the origins on every notification of the listener, including reconnections.
+func (svc *OriginServiceImpl) Watch(listener *pq.Listener) {
+	for range listener.Notify {
+		svc.Refresh()
+	}
+}
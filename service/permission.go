@@ -0,0 +1,40 @@
+package service
+
+import (
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+type Permission int
+
+const (
+	PermissionRead Permission = iota
+	PermissionWrite
+	PermissionManage
+)
+
+// isPermitted checks a permission on a resource owned by an identity, which may be shared with an organization.
+// The owner has every permission, and organization members can read and write while only admins can manage it.
+func isPermitted(orgRepo repository.OrganizationRepository, identity *model.UserIdentity, ownerID int64, organizationID *int64, perm Permission) bool {
+	if identity == nil {
+		return false
+	}
+	if identity.ID == ownerID {
+		return true
+	}
+	if organizationID == nil {
+		return false
+	}
+
+	member := orgRepo.FindMember(*organizationID, identity.ID)
+	if member == nil {
+		return false
+	}
+	switch perm {
+	case PermissionRead, PermissionWrite:
+		return true
+	case PermissionManage:
+		return member.Role == model.OrganizationRoleOwner || member.Role == model.OrganizationRoleAdmin
+	}
+	return false
+}
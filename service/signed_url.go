@@ -0,0 +1,132 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minSigningKeyLen = 32
+	maxSignedURLTTL  = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidSignature = fmt.Errorf("%w: invalid signature", ErrPermissionDenied)
+	ErrSignatureExpired = fmt.Errorf("%w: the signed URL has expired", ErrPermissionDenied)
+)
+
+// SignedURLOptions restricts requests with a signed URL. IP, which may be a CIDR, and ContentDisposition are optional.
+type SignedURLOptions struct {
+	Method             string
+	ExpireAt           time.Time
+	IP                 string
+	ContentDisposition string
+}
+
+// URLSigner signs URLs of storage files with HMAC-SHA256. Signing keys have versions like master keys, so that URLs
+// signed by an older key stay valid until the key is removed.
+type URLSigner struct {
+	keys    map[string][]byte
+	current string
+}
+
+func NewURLSigner(keys map[string][]byte, current string) (*URLSigner, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("unknown signing key version: %s", current)
+	}
+	for version, key := range keys {
+		if len(key) < minSigningKeyLen {
+			return nil, fmt.Errorf("signing key %s should be at least %d bytes", version, minSigningKeyLen)
+		}
+	}
+	return &URLSigner{keys: keys, current: current}, nil
+}
+
+// Sign returns query parameters to append to the URL of the file. URLs are signed for the storage prefix of the bucket,
+// which does not change on renames, so that they are not valid for another bucket taking the name.
+func (s *URLSigner) Sign(bucketPrefix, fileKey string, opts *SignedURLOptions) url.Values {
+	query := url.Values{}
+	query.Set("method", opts.Method)
+	query.Set("expires", strconv.FormatInt(opts.ExpireAt.Unix(), 10))
+	if opts.IP != "" {
+		query.Set("ip", opts.IP)
+	}
+	if opts.ContentDisposition != "" {
+		query.Set("disposition", opts.ContentDisposition)
+	}
+	query.Set("kid", s.current)
+	query.Set("signature", s.signature(s.keys[s.current], bucketPrefix, fileKey, query))
+	return query
+}
+
+// Verify checks the signature in the query, and whether the request is allowed by it. HEAD requests are allowed by
+// URLs signed for GET.
+func (s *URLSigner) Verify(method, bucketPrefix, fileKey, clientIP string, query url.Values) (*SignedURLOptions, error) {
+	key, ok := s.keys[query.Get("kid")]
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	expected := s.signature(key, bucketPrefix, fileKey, query)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return nil, ErrInvalidSignature
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	opts := &SignedURLOptions{
+		Method:             query.Get("method"),
+		ExpireAt:           time.Unix(expires, 0),
+		IP:                 query.Get("ip"),
+		ContentDisposition: query.Get("disposition"),
+	}
+	if time.Now().After(opts.ExpireAt) {
+		return nil, ErrSignatureExpired
+	}
+	if method != opts.Method && !(method == "HEAD" && opts.Method == "GET") {
+		return nil, fmt.Errorf("%w: the signed URL is not for %s", ErrPermissionDenied, method)
+	}
+	if opts.IP != "" && !matchIP(opts.IP, clientIP) {
+		return nil, fmt.Errorf("%w: the signed URL is not for the address", ErrPermissionDenied)
+	}
+	return opts, nil
+}
+
+// signature signs every restriction in the query with the file, so that none of them can be changed.
+func (s *URLSigner) signature(key []byte, bucketPrefix, fileKey string, query url.Values) string {
+	fields := []string{
+		query.Get("method"),
+		bucketPrefix,
+		fileKey,
+		query.Get("expires"),
+		query.Get("ip"),
+		query.Get("disposition"),
+	}
+	// Fields are escaped, so that newlines in them can not be confused with separators.
+	for i, field := range fields {
+		fields[i] = url.QueryEscape(field)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func matchIP(allowed, clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(allowed); err == nil {
+		return network.Contains(ip)
+	}
+	return ip.Equal(net.ParseIP(allowed))
+}
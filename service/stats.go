@@ -0,0 +1,141 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+const maxStatsDays = 366
+
+// StatsService counts usage of applications from the authentication path. Counts are kept in memory, and flushed to
+// the daily rollup periodically, so that recording does not add queries to requests.
+type StatsService interface {
+	RecordSignIn(applicationID, identityID int64)
+	RecordActivation(applicationID, identityID int64)
+	RecordRequest(applicationID, identityID int64)
+	Flush()
+	RunFlush(interval time.Duration)
+	GetStats(identity *model.UserIdentity, app *model.Application, from, to time.Time) ([]*model.ApplicationDailyStat, error)
+}
+
+type StatsServiceImpl struct {
+	repo    repository.ApplicationStatRepository
+	orgRepo repository.OrganizationRepository
+
+	mu       sync.Mutex
+	counters map[statKey]*statCounter
+}
+
+type statKey struct {
+	applicationID int64
+	day           string
+}
+
+type statCounter struct {
+	signIns     int64
+	activations int64
+	requests    int64
+	identities  map[int64]struct{}
+}
+
+func NewStatsService(repo repository.ApplicationStatRepository, orgRepo repository.OrganizationRepository) (StatsService, error) {
+	return &StatsServiceImpl{repo: repo, orgRepo: orgRepo, counters: map[statKey]*statCounter{}}, nil
+}
+
+func (svc *StatsServiceImpl) RecordSignIn(applicationID, identityID int64) {
+	svc.record(applicationID, identityID, func(c *statCounter) { c.signIns++ })
+}
+
+func (svc *StatsServiceImpl) RecordActivation(applicationID, identityID int64) {
+	svc.record(applicationID, identityID, func(c *statCounter) { c.activations++ })
+}
+
+func (svc *StatsServiceImpl) RecordRequest(applicationID, identityID int64) {
+	svc.record(applicationID, identityID, func(c *statCounter) { c.requests++ })
+}
+
+// Flush adds the counts in memory to the rollup, and resets them.
+func (svc *StatsServiceImpl) Flush() {
+	svc.mu.Lock()
+	counters := svc.counters
+	svc.counters = map[statKey]*statCounter{}
+	svc.mu.Unlock()
+
+	for key, counter := range counters {
+		day, _ := time.Parse("2006-01-02", key.day)
+		svc.repo.AddCounts(&model.ApplicationDailyStat{
+			ApplicationID: key.applicationID,
+			Day:           day,
+			SignIns:       counter.signIns,
+			Activations:   counter.activations,
+			Requests:      counter.requests,
+		})
+
+		identityIDs := make([]int64, 0, len(counter.identities))
+		for id := range counter.identities {
+			identityIDs = append(identityIDs, id)
+		}
+		svc.repo.AddActiveIdentities(key.applicationID, day, identityIDs)
+	}
+}
+
+func (svc *StatsServiceImpl) RunFlush(interval time.Duration) {
+	for range time.Tick(interval) {
+		svc.Flush()
+	}
+}
+
+// GetStats returns daily stats between from and to in UTC, both inclusive. Days without any usage have zero counts.
+// Counts of the last flush interval may not be included yet.
+func (svc *StatsServiceImpl) GetStats(identity *model.UserIdentity, app *model.Application, from, to time.Time) ([]*model.ApplicationDailyStat, error) {
+	if !isPermitted(svc.orgRepo, identity, int64(app.OwnerID), app.OrganizationID, PermissionManage) {
+		return nil, ErrPermissionDenied
+	}
+
+	from, to = truncateDay(from), truncateDay(to)
+	if to.Before(from) {
+		return nil, invalidArgument("the end of the range is before the start")
+	}
+	if to.Sub(from) >= maxStatsDays*24*time.Hour {
+		return nil, invalidArgument("the range is too long")
+	}
+
+	found := map[string]*model.ApplicationDailyStat{}
+	for _, stat := range svc.repo.FindByApplicationID(app.ID, from, to) {
+		found[stat.Day.Format("2006-01-02")] = stat
+	}
+
+	var stats []*model.ApplicationDailyStat
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		stat, ok := found[day.Format("2006-01-02")]
+		if !ok {
+			stat = &model.ApplicationDailyStat{ApplicationID: app.ID}
+		}
+		stat.Day = day
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+func (svc *StatsServiceImpl) record(applicationID, identityID int64, fn func(*statCounter)) {
+	key := statKey{applicationID, time.Now().UTC().Format("2006-01-02")}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	counter, ok := svc.counters[key]
+	if !ok {
+		counter = &statCounter{identities: map[int64]struct{}{}}
+		svc.counters[key] = counter
+	}
+	fn(counter)
+	counter.identities[identityID] = struct{}{}
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -1,45 +1,711 @@
 package service
 
 import (
+	"bufio"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/google/uuid"
 
+	"github.com/hellodhlyn/luppiter/blob"
+	"github.com/hellodhlyn/luppiter/model"
 	"github.com/hellodhlyn/luppiter/repository"
 )
 
+const (
+	maxObjectKeyLength = 1024
+	maxDeleteBatchSize = 1000
+	maxListSize        = 1000
+)
+
+var (
+	ErrBucketNameTaken = conflict("the bucket name is already taken")
+	ErrBucketNotEmpty  = conflict("the bucket is not empty")
+
+	bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+)
+
+// ObjectListing is a page of objects and common prefixes, ordered by keys.
+type ObjectListing struct {
+	Entries    []*model.StorageListEntry
+	NextCursor string
+}
+
+// Results of deleting objects.
+const (
+	ObjectDeleted  = "deleted"
+	ObjectNotFound = "not_found"
+	ObjectFailed   = "failed"
+)
+
+type ObjectDeleteResult struct {
+	Key    string
+	Status string
+	Error  string
+}
+
 type StorageService interface {
-	ReadFile(bucketName, fileKey string) (io.ReadCloser, error)
+	ReadFile(identity *model.UserIdentity, bucketName, fileKey string) (*StorageFile, error)
+	ReadSignedFile(bucketName, fileKey, method, clientIP string, query url.Values) (*StorageFile, *SignedURLOptions, error)
+	SignURL(identity *model.UserIdentity, bucketName, fileKey string, opts *SignedURLOptions) (string, error)
+	WriteFile(identity *model.UserIdentity, bucketName, fileKey, contentType string, body io.Reader) (*model.StorageObject, error)
+	HasPermission(identity *model.UserIdentity, bucket *model.StorageBucket, perm Permission) bool
+	DeleteFiles(identity *model.UserIdentity, bucketName string, keys []string) ([]*ObjectDeleteResult, error)
+	DeleteFilesByPrefix(identity *model.UserIdentity, bucketName, prefix string) ([]*ObjectDeleteResult, bool, error)
+	ListFiles(identity *model.UserIdentity, bucketName, prefix, delimiter, cursor string, limit int) (*ObjectListing, error)
+	MaxObjectSize() int64
+
+	CreateUpload(identity *model.UserIdentity, bucketName, fileKey, contentType string, size int64, parts int) (*UploadSession, error)
+	CompleteUpload(identity *model.UserIdentity, bucketName, fileKey, uploadUUID string, parts []*UploadedPart) (*model.StorageObject, error)
+	AbortUpload(identity *model.UserIdentity, bucketName, fileKey, uploadUUID string) error
+	ExpireUploads() int
+	RunUploadCleanup(interval time.Duration)
+
+	FindBucket(name string) *model.StorageBucket
+	CreateBucket(owner *model.UserIdentity, name, orgUUID string, isPublic bool) (*model.StorageBucket, error)
+	ListBuckets(identity *model.UserIdentity) []*model.StorageBucket
+	UpdateBucket(identity *model.UserIdentity, bucket *model.StorageBucket, name string, isPublic bool, cacheControl string) error
+	DeleteBucket(identity *model.UserIdentity, bucket *model.StorageBucket, purge bool) error
+	PurgeBuckets() int
+	RunPurge(interval time.Duration)
+	BackfillObjects() int
 }
 
 type StorageServiceImpl struct {
-	bucketRepo   repository.StorageBucketRepository
-	s3           *s3.S3
-	s3BucketName string
+	bucketRepo    repository.StorageBucketRepository
+	objectRepo    repository.StorageObjectRepository
+	uploadRepo    repository.StorageUploadRepository
+	orgRepo       repository.OrganizationRepository
+	backend       blob.Backend
+	maxObjectSize int64
+	signer        *URLSigner
 }
 
-func NewStorageService(bucketRepo repository.StorageBucketRepository, s3 *s3.S3) (StorageService, error) {
+func NewStorageService(
+	bucketRepo repository.StorageBucketRepository,
+	objectRepo repository.StorageObjectRepository,
+	uploadRepo repository.StorageUploadRepository,
+	orgRepo repository.OrganizationRepository,
+	backend blob.Backend,
+	maxObjectSize int64,
+	signer *URLSigner,
+) (StorageService, error) {
 	return &StorageServiceImpl{
-		bucketRepo:   bucketRepo,
-		s3:           s3,
-		s3BucketName: "luppiter.lynlab.co.kr",
+		bucketRepo:    bucketRepo,
+		objectRepo:    objectRepo,
+		uploadRepo:    uploadRepo,
+		orgRepo:       orgRepo,
+		backend:       backend,
+		maxObjectSize: maxObjectSize,
+		signer:        signer,
 	}, nil
 }
 
-func (svc *StorageServiceImpl) ReadFile(bucketName, fileKey string) (io.ReadCloser, error) {
-	if svc.bucketRepo.FindByName(bucketName) == nil {
+// ReadFile reads the file. Files of private buckets are readable only by identities permitted to read the bucket, and
+// the bucket is regarded as missing for others, so that its name is not exposed. The identity may be nil for anonymous
+// callers.
+func (svc *StorageServiceImpl) ReadFile(identity *model.UserIdentity, bucketName, fileKey string) (*StorageFile, error) {
+	bucket := svc.bucketRepo.FindByName(bucketName)
+	if bucket == nil {
 		return nil, nil
 	}
+	if !bucket.IsPublic {
+		if !svc.HasPermission(identity, bucket, PermissionRead) {
+			return nil, nil
+		}
+		if err := checkIdentityStatus(&bucket.Owner); err != nil {
+			return nil, err
+		}
+	}
+	return svc.readFile(bucket, fileKey)
+}
+
+// ReadSignedFile reads the file with a URL signed by SignURL, in place of the permission of an identity. It returns
+// the options of the signed URL, to respond as they restrict.
+func (svc *StorageServiceImpl) ReadSignedFile(bucketName, fileKey, method, clientIP string, query url.Values) (*StorageFile, *SignedURLOptions, error) {
+	if svc.signer == nil {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	// Missing buckets are not exposed to requests without valid signatures.
+	bucket := svc.bucketRepo.FindByName(bucketName)
+	if bucket == nil {
+		return nil, nil, ErrInvalidSignature
+	}
+	opts, err := svc.signer.Verify(method, bucket.StoragePrefix, fileKey, clientIP, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bucket.IsPublic {
+		if err := checkIdentityStatus(&bucket.Owner); err != nil {
+			return nil, nil, err
+		}
+	}
+	file, err := svc.readFile(bucket, fileKey)
+	return file, opts, err
+}
+
+// SignURL returns the path of the file with a signature, which lets anyone read the file until it expires. The
+// identity should be able to read the bucket.
+func (svc *StorageServiceImpl) SignURL(identity *model.UserIdentity, bucketName, fileKey string, opts *SignedURLOptions) (string, error) {
+	if svc.signer == nil {
+		return "", errors.New("signing keys are not configured")
+	}
+
+	bucket := svc.bucketRepo.FindByName(bucketName)
+	if bucket == nil || !svc.HasPermission(identity, bucket, PermissionRead) {
+		return "", fmt.Errorf("%w: no such bucket", ErrNotFound)
+	}
+	if fileKey == "" {
+		return "", invalidArgument("key is required")
+	}
+	if err := validateSignedURLOptions(opts); err != nil {
+		return "", err
+	}
 
-	output, err := svc.s3.GetObject(&s3.GetObjectInput{
-		Bucket: aws.String(svc.s3BucketName),
-		Key:    aws.String(fmt.Sprintf("%s/%s", bucketName, fileKey)),
-	})
+	u := url.URL{
+		Path:     "/storage/" + bucket.Name + "/" + fileKey,
+		RawQuery: svc.signer.Sign(bucket.StoragePrefix, fileKey, opts).Encode(),
+	}
+	return u.String(), nil
+}
+
+// readFile returns the metadata of the file, or nil if the file does not exist. The content is not read until opened.
+func (svc *StorageServiceImpl) readFile(bucket *model.StorageBucket, fileKey string) (*StorageFile, error) {
+	file := &StorageFile{
+		Key:          fileKey,
+		CacheControl: cacheControl(bucket),
+		backend:      svc.backend,
+		blobKey:      blobKey(bucket, fileKey),
+	}
+	if object := svc.objectRepo.Find(bucket.ID, fileKey); object != nil {
+		file.ContentType = object.ContentType
+		file.Size = object.Size
+		file.ETag = object.ETag
+		if object.UpdatedAt != nil {
+			file.LastModified = *object.UpdatedAt
+		}
+		return file, nil
+	}
 
+	// Files uploaded before the metadata was recorded are only in the backend.
+	info, err := svc.backend.Stat(file.blobKey)
+	if err == blob.ErrNotFound || err == blob.ErrInvalidKey {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	file.ContentType = info.ContentType
+	file.Size = info.Size
+	file.ETag = info.ETag
+	file.LastModified = info.LastModified
+	if file.ContentType == "" {
+		file.ContentType = "application/octet-stream"
+	}
+	return file, nil
+}
+
+// WriteFile streams the body to the bucket, and records the metadata of the file. The content type is guessed from the
+// key or the content if not given. Bodies larger than the maximum object size are rejected.
+func (svc *StorageServiceImpl) WriteFile(identity *model.UserIdentity, bucketName, fileKey, contentType string, body io.Reader) (*model.StorageObject, error) {
+	bucket, err := svc.findWritableBucket(identity, bucketName)
 	if err != nil {
 		return nil, err
 	}
-	return output.Body, nil
+	if fileKey == "" || len(fileKey) > maxObjectKeyLength {
+		return nil, invalidArgument("key should be 1 to 1024 bytes long")
+	}
+
+	reader := bufio.NewReader(body)
+	if contentType == "" {
+		contentType = detectContentType(fileKey, reader)
+	}
+
+	counter := &objectReader{r: reader, max: svc.maxObjectSize, hash: md5.New()}
+	err = svc.backend.Put(blobKey(bucket, fileKey), counter, contentType)
+	if counter.err != nil {
+		return nil, counter.err
+	}
+	if errors.Is(err, blob.ErrInvalidKey) {
+		return nil, invalidArgument("the key is not supported by the storage backend")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	object := svc.objectRepo.Find(bucket.ID, fileKey)
+	if object == nil {
+		object = &model.StorageObject{BucketID: bucket.ID, Key: fileKey}
+	}
+	object.ContentType = contentType
+	object.Size = counter.n
+	object.ETag = hex.EncodeToString(counter.hash.Sum(nil))
+	svc.objectRepo.Save(object)
+	return object, nil
+}
+
+// DeleteFiles deletes files of the keys, up to 1000 at once. Keys which do not exist are reported as not found.
+func (svc *StorageServiceImpl) DeleteFiles(identity *model.UserIdentity, bucketName string, keys []string) ([]*ObjectDeleteResult, error) {
+	bucket, err := svc.findWritableBucket(identity, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, invalidArgument("keys are required")
+	}
+	if len(keys) > maxDeleteBatchSize {
+		return nil, invalidArgument(fmt.Sprintf("up to %d keys can be deleted at once", maxDeleteBatchSize))
+	}
+
+	found := map[string]bool{}
+	for _, object := range svc.objectRepo.FindByKeys(bucket.ID, keys) {
+		found[object.Key] = true
+	}
+
+	var existing []string
+	results := make([]*ObjectDeleteResult, len(keys))
+	for i, key := range keys {
+		results[i] = &ObjectDeleteResult{Key: key, Status: ObjectDeleted}
+		// Files uploaded before the metadata was recorded are only in the backend.
+		if !found[key] && !svc.exists(bucket, key) {
+			results[i].Status = ObjectNotFound
+			continue
+		}
+		existing = append(existing, key)
+	}
+
+	svc.deleteObjects(bucket, existing, results)
+	return results, nil
+}
+
+// DeleteFilesByPrefix deletes files whose keys start with the prefix, up to 1000 at once. It returns whether more files
+// are left, so that callers can repeat it.
+func (svc *StorageServiceImpl) DeleteFilesByPrefix(identity *model.UserIdentity, bucketName, prefix string) ([]*ObjectDeleteResult, bool, error) {
+	bucket, err := svc.findWritableBucket(identity, bucketName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	objects := svc.objectRepo.FindByPrefix(bucket.ID, prefix, maxDeleteBatchSize+1)
+	truncated := len(objects) > maxDeleteBatchSize
+	if truncated {
+		objects = objects[:maxDeleteBatchSize]
+	}
+
+	keys := make([]string, len(objects))
+	results := make([]*ObjectDeleteResult, len(objects))
+	for i, object := range objects {
+		keys[i] = object.Key
+		results[i] = &ObjectDeleteResult{Key: object.Key, Status: ObjectDeleted}
+	}
+	svc.deleteObjects(bucket, keys, results)
+	return results, truncated, nil
+}
+
+// deleteObjects deletes the keys from the backend and the metadata, and marks results of keys failed to delete.
+func (svc *StorageServiceImpl) deleteObjects(bucket *model.StorageBucket, keys []string, results []*ObjectDeleteResult) {
+	if len(keys) == 0 {
+		return
+	}
+
+	blobKeys := make([]string, len(keys))
+	for i, key := range keys {
+		blobKeys[i] = blobKey(bucket, key)
+	}
+	errs, err := svc.backend.Delete(blobKeys)
+
+	failed := map[string]string{}
+	if err != nil {
+		for _, key := range keys {
+			failed[key] = err.Error()
+		}
+	} else {
+		for key, e := range errs {
+			failed[strings.TrimPrefix(key, bucket.StoragePrefix+"/")] = e.Error()
+		}
+	}
+
+	deleted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := failed[key]; !ok {
+			deleted = append(deleted, key)
+		}
+	}
+	if len(deleted) > 0 {
+		svc.objectRepo.DeleteByKeys(bucket.ID, deleted)
+	}
+
+	for _, result := range results {
+		if message, ok := failed[result.Key]; ok {
+			result.Status = ObjectFailed
+			result.Error = message
+		}
+	}
+}
+
+// ListFiles lists files of the bucket. The cursor is opaque to callers, and the next cursor is empty on the last page.
+func (svc *StorageServiceImpl) ListFiles(identity *model.UserIdentity, bucketName, prefix, delimiter, cursor string, limit int) (*ObjectListing, error) {
+	bucket := svc.bucketRepo.FindByName(bucketName)
+	if bucket == nil {
+		return nil, fmt.Errorf("%w: no such bucket", ErrNotFound)
+	}
+	if !svc.HasPermission(identity, bucket, PermissionRead) {
+		return nil, svc.denyBucket(identity, bucket)
+	}
+	if limit <= 0 || limit > maxListSize {
+		limit = maxListSize
+	}
+
+	after := ""
+	if cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, invalidArgument("invalid cursor")
+		}
+		after = string(decoded)
+	}
+
+	entries := svc.objectRepo.List(bucket.ID, prefix, delimiter, after, limit+1)
+	listing := &ObjectListing{Entries: entries}
+	if len(entries) > limit {
+		listing.Entries = entries[:limit]
+		last := listing.Entries[limit-1]
+		lastKey := last.Prefix
+		if last.Object != nil {
+			lastKey = last.Object.Key
+		}
+		listing.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(lastKey))
+	}
+	return listing, nil
+}
+
+func (svc *StorageServiceImpl) exists(bucket *model.StorageBucket, fileKey string) bool {
+	exists, _ := svc.backend.Head(blobKey(bucket, fileKey))
+	return exists
+}
+
+func (svc *StorageServiceImpl) findWritableBucket(identity *model.UserIdentity, bucketName string) (*model.StorageBucket, error) {
+	bucket := svc.bucketRepo.FindByName(bucketName)
+	if bucket == nil {
+		return nil, fmt.Errorf("%w: no such bucket", ErrNotFound)
+	}
+	if !svc.HasPermission(identity, bucket, PermissionWrite) {
+		return nil, svc.denyBucket(identity, bucket)
+	}
+	return bucket, nil
+}
+
+// denyBucket returns the error for identities without a permission on the bucket. Private buckets are regarded as
+// missing for identities which can not read them, so that their names are not exposed.
+func (svc *StorageServiceImpl) denyBucket(identity *model.UserIdentity, bucket *model.StorageBucket) error {
+	if !bucket.IsPublic && !svc.HasPermission(identity, bucket, PermissionRead) {
+		return fmt.Errorf("%w: no such bucket", ErrNotFound)
+	}
+	return ErrPermissionDenied
+}
+
+func (svc *StorageServiceImpl) MaxObjectSize() int64 {
+	return svc.maxObjectSize
+}
+
+func (svc *StorageServiceImpl) FindBucket(name string) *model.StorageBucket {
+	return svc.bucketRepo.FindByName(name)
+}
+
+// CreateBucket creates a bucket. If the organization is given, the owner should be an admin of it.
+func (svc *StorageServiceImpl) CreateBucket(owner *model.UserIdentity, name, orgUUID string, isPublic bool) (*model.StorageBucket, error) {
+	if err := svc.checkBucketName(name); err != nil {
+		return nil, err
+	}
+
+	bucket := &model.StorageBucket{
+		OwnerID:       owner.ID,
+		Name:          name,
+		IsPublic:      isPublic,
+		StoragePrefix: uuid.New().String(),
+	}
+	if orgUUID != "" {
+		org := svc.orgRepo.FindByUUID(orgUUID)
+		if org == nil {
+			return nil, fmt.Errorf("%w: no such organization", ErrNotFound)
+		}
+		if !isPermitted(svc.orgRepo, owner, 0, &org.ID, PermissionManage) {
+			return nil, ErrPermissionDenied
+		}
+		bucket.OrganizationID = &org.ID
+	}
+	svc.bucketRepo.Save(bucket)
+	return bucket, nil
+}
+
+func (svc *StorageServiceImpl) ListBuckets(identity *model.UserIdentity) []*model.StorageBucket {
+	return svc.bucketRepo.FindByIdentityID(identity.ID)
+}
+
+// UpdateBucket renames the bucket, and changes whether it is public and its Cache-Control. Files are kept on renames.
+func (svc *StorageServiceImpl) UpdateBucket(identity *model.UserIdentity, bucket *model.StorageBucket, name string, isPublic bool, cacheControl string) error {
+	if !svc.HasPermission(identity, bucket, PermissionManage) {
+		return svc.denyBucket(identity, bucket)
+	}
+	if name != bucket.Name {
+		if err := svc.checkBucketName(name); err != nil {
+			return err
+		}
+	}
+
+	if len(cacheControl) > 255 || strings.ContainsAny(cacheControl, "\r\n") {
+		return invalidArgument("invalid cache control")
+	}
+
+	bucket.Name = name
+	bucket.IsPublic = isPublic
+	bucket.CacheControl = cacheControl
+	svc.bucketRepo.Save(bucket)
+	return nil
+}
+
+// DeleteBucket deletes the bucket if it is empty. With purge, files are deleted in the background, and the bucket is
+// deleted after them. The name is not available until then.
+func (svc *StorageServiceImpl) DeleteBucket(identity *model.UserIdentity, bucket *model.StorageBucket, purge bool) error {
+	if !svc.HasPermission(identity, bucket, PermissionManage) {
+		return svc.denyBucket(identity, bucket)
+	}
+
+	if purge {
+		now := time.Now()
+		bucket.PurgeRequestedAt = &now
+		svc.bucketRepo.Save(bucket)
+		return nil
+	}
+
+	if len(svc.objectRepo.FindByPrefix(bucket.ID, "", 1)) > 0 || len(svc.listBlobKeys(bucket, 1)) > 0 {
+		return ErrBucketNotEmpty
+	}
+	svc.bucketRepo.Delete(bucket)
+	return nil
+}
+
+// PurgeBuckets deletes files of buckets requested to purge, and the buckets after all of their files are deleted. It
+// returns the number of deleted buckets.
+func (svc *StorageServiceImpl) PurgeBuckets() int {
+	purged := 0
+	for _, bucket := range svc.bucketRepo.FindPurging(10) {
+		if svc.purgeBucket(bucket) {
+			svc.bucketRepo.Delete(bucket)
+			purged++
+		}
+	}
+	return purged
+}
+
+func (svc *StorageServiceImpl) RunPurge(interval time.Duration) {
+	for range time.Tick(interval) {
+		if purged := svc.PurgeBuckets(); purged > 0 {
+			log.Printf("purged %d storage buckets", purged)
+		}
+	}
+}
+
+// BackfillObjects records the metadata of files uploaded before it was recorded, which are only in the backend, so that
+// they are listed. It returns the number of recorded files.
+func (svc *StorageServiceImpl) BackfillObjects() int {
+	created := 0
+	lastID := int64(0)
+	for {
+		buckets := svc.bucketRepo.FindAfterID(lastID, 100)
+		if len(buckets) == 0 {
+			return created
+		}
+		for _, bucket := range buckets {
+			lastID = bucket.ID
+			created += svc.backfillBucket(bucket)
+		}
+	}
+}
+
+func (svc *StorageServiceImpl) backfillBucket(bucket *model.StorageBucket) int {
+	created := 0
+	prefix := bucket.StoragePrefix + "/"
+	after := ""
+	for {
+		infos, err := svc.backend.List(prefix, after, maxDeleteBatchSize)
+		if err != nil {
+			log.Printf("failed to list files of bucket %d: %v", bucket.ID, err)
+			return created
+		}
+		if len(infos) == 0 {
+			return created
+		}
+
+		for _, info := range infos {
+			after = info.Key
+			// Listings of some backends do not have content types.
+			if info.ContentType == "" {
+				if stat, err := svc.backend.Stat(info.Key); err == nil {
+					info.ContentType = stat.ContentType
+				}
+			}
+			if info.ContentType == "" {
+				info.ContentType = "application/octet-stream"
+			}
+
+			object := &model.StorageObject{
+				ModelMixin:  model.ModelMixin{CreatedAt: &info.LastModified, UpdatedAt: &info.LastModified},
+				BucketID:    bucket.ID,
+				Key:         strings.TrimPrefix(info.Key, prefix),
+				ContentType: info.ContentType,
+				Size:        info.Size,
+				ETag:        info.ETag,
+			}
+			if svc.objectRepo.CreateIfMissing(object) {
+				created++
+			}
+		}
+	}
+}
+
+// purgeBucket deletes every file of the bucket, and returns whether all of them are deleted.
+func (svc *StorageServiceImpl) purgeBucket(bucket *model.StorageBucket) bool {
+	for {
+		objects := svc.objectRepo.FindByPrefix(bucket.ID, "", maxDeleteBatchSize)
+		if len(objects) == 0 {
+			break
+		}
+
+		keys := make([]string, len(objects))
+		results := make([]*ObjectDeleteResult, len(objects))
+		for i, object := range objects {
+			keys[i] = object.Key
+			results[i] = &ObjectDeleteResult{Key: object.Key, Status: ObjectDeleted}
+		}
+		svc.deleteObjects(bucket, keys, results)
+		for _, result := range results {
+			if result.Status == ObjectFailed {
+				log.Printf("failed to purge %s of bucket %d: %s", result.Key, bucket.ID, result.Error)
+				return false
+			}
+		}
+	}
+
+	// Files uploaded before the metadata was recorded are only in the backend.
+	for {
+		keys := svc.listBlobKeys(bucket, maxDeleteBatchSize)
+		if len(keys) == 0 {
+			return true
+		}
+
+		results := make([]*ObjectDeleteResult, len(keys))
+		for i, key := range keys {
+			results[i] = &ObjectDeleteResult{Key: key, Status: ObjectDeleted}
+		}
+		svc.deleteObjects(bucket, keys, results)
+		for _, result := range results {
+			if result.Status == ObjectFailed {
+				log.Printf("failed to purge %s of bucket %d: %s", result.Key, bucket.ID, result.Error)
+				return false
+			}
+		}
+	}
+}
+
+// listBlobKeys returns keys of files of the bucket in the backend, without the prefix of the bucket.
+func (svc *StorageServiceImpl) listBlobKeys(bucket *model.StorageBucket, limit int) []string {
+	infos, err := svc.backend.List(bucket.StoragePrefix+"/", "", limit)
+	if err != nil {
+		log.Printf("failed to list files of bucket %d: %v", bucket.ID, err)
+		return nil
+	}
+
+	keys := make([]string, len(infos))
+	for i, info := range infos {
+		keys[i] = strings.TrimPrefix(info.Key, bucket.StoragePrefix+"/")
+	}
+	return keys
+}
+
+func (svc *StorageServiceImpl) checkBucketName(name string) error {
+	if !bucketNamePattern.MatchString(name) {
+		return invalidArgument("bucket names should be 3 to 63 lowercase letters, digits, dots or hyphens")
+	}
+	if svc.bucketRepo.ExistsByName(name) {
+		return ErrBucketNameTaken
+	}
+	return nil
+}
+
+func validateSignedURLOptions(opts *SignedURLOptions) error {
+	if opts.Method == "" {
+		opts.Method = "GET"
+	}
+	if opts.Method != "GET" && opts.Method != "HEAD" {
+		return invalidArgument("signed URLs are only for GET or HEAD")
+	}
+
+	ttl := time.Until(opts.ExpireAt)
+	if ttl <= 0 || ttl > maxSignedURLTTL {
+		return invalidArgument("signed URLs should expire in 7 days")
+	}
+
+	if opts.IP != "" && net.ParseIP(opts.IP) == nil {
+		if _, _, err := net.ParseCIDR(opts.IP); err != nil {
+			return invalidArgument("ip should be an IP address or a CIDR")
+		}
+	}
+	if opts.ContentDisposition != "" {
+		disposition, _, err := mime.ParseMediaType(opts.ContentDisposition)
+		if err != nil || (disposition != "inline" && disposition != "attachment") {
+			return invalidArgument("content disposition should be inline or attachment")
+		}
+	}
+	return nil
+}
+
+func (svc *StorageServiceImpl) HasPermission(identity *model.UserIdentity, bucket *model.StorageBucket, perm Permission) bool {
+	return isPermitted(svc.orgRepo, identity, bucket.OwnerID, bucket.OrganizationID, perm)
+}
+
+// objectReader counts and hashes bytes read, and fails when more than the maximum is read.
+type objectReader struct {
+	r    io.Reader
+	max  int64
+	n    int64
+	hash hash.Hash
+	err  error
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.n > r.max {
+		r.err = fmt.Errorf("%w: objects should not be larger than %d bytes", ErrTooLarge, r.max)
+		return 0, r.err
+	}
+	r.hash.Write(p[:n])
+	return n, err
+}
+
+func detectContentType(fileKey string, reader *bufio.Reader) string {
+	if contentType := mime.TypeByExtension(path.Ext(fileKey)); contentType != "" {
+		return contentType
+	}
+	head, _ := reader.Peek(512)
+	return http.DetectContentType(head)
+}
+
+func blobKey(bucket *model.StorageBucket, fileKey string) string {
+	return bucket.StoragePrefix + "/" + fileKey
 }
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/blob"
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+const (
+	defaultPublicCacheControl = "public, max-age=3600"
+	privateCacheControl       = "private, no-cache"
+)
+
+// StorageFile is the metadata of a file to respond. The content is read from the backend only when it is opened, so
+// that conditional requests can be answered without reading it.
+type StorageFile struct {
+	Key          string
+	ContentType  string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	CacheControl string
+
+	backend blob.Backend
+	blobKey string
+}
+
+// Open reads the content. The size is updated as the backend responds, in case the metadata is stale.
+func (f *StorageFile) Open() (io.ReadCloser, error) {
+	body, info, err := f.backend.Get(f.blobKey)
+	if err == blob.ErrNotFound {
+		return nil, fmt.Errorf("%w: no such file", ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	f.Size = info.Size
+	return body, nil
+}
+
+// OpenRange reads the content from the offset, up to the length. Ranges are read by the backend, not by skipping the
+// content.
+func (f *StorageFile) OpenRange(offset, length int64) (io.ReadCloser, error) {
+	body, err := f.backend.GetRange(f.blobKey, offset, length)
+	if err == blob.ErrNotFound {
+		return nil, fmt.Errorf("%w: no such file", ErrNotFound)
+	}
+	return body, err
+}
+
+// cacheControl returns Cache-Control of files of the bucket. Files of private buckets are never cached by shared caches
+// such as CDNs, regardless of the setting of the bucket.
+func cacheControl(bucket *model.StorageBucket) string {
+	if !bucket.IsPublic {
+		return privateCacheControl
+	}
+	if bucket.CacheControl != "" {
+		return bucket.CacheControl
+	}
+	return defaultPublicCacheControl
+}
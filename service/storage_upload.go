@@ -0,0 +1,271 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hellodhlyn/luppiter/blob"
+	"github.com/hellodhlyn/luppiter/model"
+)
+
+const (
+	uploadTTL              = 24 * time.Hour
+	uploadCleanupBatchSize = 100
+
+	// Limits of S3 on uploads
+	maxSingleUploadSize = 5 << 30
+	maxUploadParts      = 10000
+)
+
+var (
+	ErrNoSuchUpload           = fmt.Errorf("%w: no such upload", ErrNotFound)
+	ErrDirectUploadNotAllowed = invalidArgument("direct uploads are not supported by the storage backend")
+)
+
+// UploadSession is a created upload, with presigned URLs to upload the file or each part of it directly to the backend.
+type UploadSession struct {
+	Upload   *model.StorageUpload
+	URL      string
+	PartURLs []string
+}
+
+// UploadedPart is a part of a multipart upload, with the ETag responded by S3 on uploading it.
+type UploadedPart struct {
+	PartNumber int64
+	ETag       string
+}
+
+// CreateUpload starts an upload of the file. If parts is 0, it returns a URL to upload the whole file of the size at
+// once. Otherwise, it starts a multipart upload, and returns a URL for each part. The upload should be completed by
+// CompleteUpload until it expires.
+func (svc *StorageServiceImpl) CreateUpload(identity *model.UserIdentity, bucketName, fileKey, contentType string, size int64, parts int) (*UploadSession, error) {
+	uploader, ok := svc.backend.(blob.DirectUploader)
+	if !ok {
+		return nil, ErrDirectUploadNotAllowed
+	}
+	bucket, err := svc.findWritableBucket(identity, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if fileKey == "" || len(fileKey) > maxObjectKeyLength {
+		return nil, invalidArgument("key should be 1 to 1024 bytes long")
+	}
+	if parts < 0 || parts > maxUploadParts {
+		return nil, invalidArgument(fmt.Sprintf("parts should be up to %d", maxUploadParts))
+	}
+	if size > svc.maxObjectSize {
+		return nil, invalidArgument(fmt.Sprintf("size should be up to %d bytes", svc.maxObjectSize))
+	}
+	if parts == 0 && (size < 0 || size > maxSingleUploadSize) {
+		return nil, invalidArgument("size should be up to 5 GiB. Upload larger files in parts.")
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(fileKey))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	upload := &model.StorageUpload{
+		UUID:        uuid.New().String(),
+		BucketID:    bucket.ID,
+		IdentityID:  identity.ID,
+		Key:         fileKey,
+		ContentType: contentType,
+		ExpireAt:    time.Now().Add(uploadTTL),
+	}
+	session := &UploadSession{Upload: upload}
+
+	if parts == 0 {
+		upload.Size = size
+		session.URL, err = uploader.PresignPut(blobKey(bucket, fileKey), contentType, size, uploadTTL)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		upload.MultipartID, err = uploader.CreateMultipartUpload(blobKey(bucket, fileKey), contentType)
+		if err != nil {
+			return nil, err
+		}
+
+		session.PartURLs = make([]string, parts)
+		for i := range session.PartURLs {
+			session.PartURLs[i], err = uploader.PresignUploadPart(blobKey(bucket, fileKey), upload.MultipartID, int64(i+1), uploadTTL)
+			if err != nil {
+				_ = uploader.AbortMultipartUpload(blobKey(bucket, fileKey), upload.MultipartID)
+				return nil, err
+			}
+		}
+	}
+
+	svc.uploadRepo.Save(upload)
+	return session, nil
+}
+
+// CompleteUpload records the uploaded file. For multipart uploads, parts should be every uploaded part in order, with
+// ETags matching the ones in S3. Files larger than the maximum object size, or than the size of a single upload, are
+// deleted and rejected.
+func (svc *StorageServiceImpl) CompleteUpload(identity *model.UserIdentity, bucketName, fileKey, uploadUUID string, parts []*UploadedPart) (*model.StorageObject, error) {
+	bucket, upload, err := svc.findUpload(identity, bucketName, fileKey, uploadUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.IsMultipart() {
+		if err := svc.completeMultipartUpload(bucket, upload, parts); err != nil {
+			return nil, err
+		}
+	}
+
+	info, err := svc.backend.Stat(blobKey(bucket, fileKey))
+	if err == blob.ErrNotFound || (err == nil && !isUploadedBy(info, upload)) {
+		return nil, invalidArgument("the file is not uploaded yet")
+	} else if err != nil {
+		return nil, err
+	}
+	if info.Size > svc.maxObjectSize || (!upload.IsMultipart() && info.Size != upload.Size) {
+		svc.rejectUpload(bucket, upload)
+		return nil, invalidArgument(fmt.Sprintf("the uploaded file should be %d bytes, up to %d bytes", upload.Size, svc.maxObjectSize))
+	}
+
+	object := svc.objectRepo.Find(bucket.ID, fileKey)
+	if object == nil {
+		object = &model.StorageObject{BucketID: bucket.ID, Key: fileKey}
+	}
+	object.ContentType = upload.ContentType
+	object.Size = info.Size
+	object.ETag = info.ETag
+	svc.objectRepo.Save(object)
+
+	svc.uploadRepo.Delete(upload)
+	return object, nil
+}
+
+// AbortUpload cancels the upload, and deletes parts uploaded so far.
+func (svc *StorageServiceImpl) AbortUpload(identity *model.UserIdentity, bucketName, fileKey, uploadUUID string) error {
+	bucket, upload, err := svc.findUpload(identity, bucketName, fileKey, uploadUUID)
+	if err != nil {
+		return err
+	}
+	if upload.IsMultipart() {
+		if err := svc.abortMultipartUpload(bucket, upload); err != nil {
+			return err
+		}
+	}
+	svc.uploadRepo.Delete(upload)
+	return nil
+}
+
+// ExpireUploads aborts uploads which are not completed in time, and returns the number of them.
+func (svc *StorageServiceImpl) ExpireUploads() int {
+	expired := 0
+	for _, upload := range svc.uploadRepo.FindExpired(time.Now(), uploadCleanupBatchSize) {
+		// Uploads of deleted buckets are left to the backend, such as lifecycle rules of S3.
+		if bucket := svc.bucketRepo.FindByID(upload.BucketID); bucket != nil && upload.IsMultipart() {
+			if err := svc.abortMultipartUpload(bucket, upload); err != nil {
+				log.Printf("failed to abort upload %s: %v", upload.UUID, err)
+				continue
+			}
+		}
+		svc.uploadRepo.Delete(upload)
+		expired++
+	}
+	return expired
+}
+
+func (svc *StorageServiceImpl) RunUploadCleanup(interval time.Duration) {
+	for range time.Tick(interval) {
+		if expired := svc.ExpireUploads(); expired > 0 {
+			log.Printf("expired %d storage uploads", expired)
+		}
+	}
+}
+
+// isUploadedBy returns whether the blob is uploaded by the upload. Until the file of a single upload is uploaded, the
+// blob may be an existing file of the key, modified before the upload is created. Files of multipart uploads are
+// written by completing them. S3 tracks modified times by seconds.
+func isUploadedBy(info *blob.Info, upload *model.StorageUpload) bool {
+	if upload.IsMultipart() {
+		return true
+	}
+	return upload.CreatedAt != nil && !info.LastModified.Before(upload.CreatedAt.Truncate(time.Second))
+}
+
+// rejectUpload deletes the uploaded file with the upload. The file may have replaced an existing one, so the metadata of
+// the key is deleted as well.
+func (svc *StorageServiceImpl) rejectUpload(bucket *model.StorageBucket, upload *model.StorageUpload) {
+	key := blobKey(bucket, upload.Key)
+	failed, err := svc.backend.Delete([]string{key})
+	if err == nil {
+		err = failed[key]
+	}
+	if err != nil {
+		log.Printf("failed to delete the rejected upload %s: %v", upload.UUID, err)
+	}
+	svc.objectRepo.DeleteByKeys(bucket.ID, []string{upload.Key})
+	svc.uploadRepo.Delete(upload)
+}
+
+// findUpload finds the upload of the file, which only its creator can access.
+func (svc *StorageServiceImpl) findUpload(identity *model.UserIdentity, bucketName, fileKey, uploadUUID string) (*model.StorageBucket, *model.StorageUpload, error) {
+	bucket, err := svc.findWritableBucket(identity, bucketName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	upload := svc.uploadRepo.FindByUUID(uploadUUID)
+	if upload == nil || upload.BucketID != bucket.ID || upload.Key != fileKey || upload.IdentityID != identity.ID ||
+		upload.ExpireAt.Before(time.Now()) {
+		return nil, nil, ErrNoSuchUpload
+	}
+	return bucket, upload, nil
+}
+
+func (svc *StorageServiceImpl) completeMultipartUpload(bucket *model.StorageBucket, upload *model.StorageUpload, parts []*UploadedPart) error {
+	uploader, ok := svc.backend.(blob.DirectUploader)
+	if !ok {
+		return ErrDirectUploadNotAllowed
+	}
+	if len(parts) == 0 {
+		return invalidArgument("parts are required")
+	}
+	for i := 1; i < len(parts); i++ {
+		if parts[i].PartNumber <= parts[i-1].PartNumber {
+			return invalidArgument("parts should be in order of part numbers")
+		}
+	}
+
+	uploaded, err := uploader.ListParts(blobKey(bucket, upload.Key), upload.MultipartID)
+	if err != nil {
+		return err
+	}
+	completed := make([]*blob.Part, len(parts))
+	for i, part := range parts {
+		etag := strings.Trim(part.ETag, `"`)
+		if uploaded[part.PartNumber] != etag {
+			return invalidArgument(fmt.Sprintf("part %d is not uploaded, or its etag does not match", part.PartNumber))
+		}
+		completed[i] = &blob.Part{PartNumber: part.PartNumber, ETag: etag}
+	}
+
+	err = uploader.CompleteMultipartUpload(blobKey(bucket, upload.Key), upload.MultipartID, completed)
+	if errors.Is(err, blob.ErrInvalidPart) {
+		return invalidArgument(err.Error())
+	}
+	return err
+}
+
+func (svc *StorageServiceImpl) abortMultipartUpload(bucket *model.StorageBucket, upload *model.StorageUpload) error {
+	uploader, ok := svc.backend.(blob.DirectUploader)
+	if !ok {
+		return nil
+	}
+	return uploader.AbortMultipartUpload(blobKey(bucket, upload.Key), upload.MultipartID)
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hellodhlyn/luppiter/blob"
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+const testMaxObjectSize = 16
+
+// memoryUploader stands in for S3. Clients upload to presigned URLs by Put and uploadPart.
+type memoryUploader struct {
+	*blob.MemoryBackend
+	parts map[int64][]byte
+}
+
+func (uploader *memoryUploader) PresignPut(key, contentType string, size int64, ttl time.Duration) (string, error) {
+	return "memory:" + key, nil
+}
+
+func (uploader *memoryUploader) CreateMultipartUpload(key, contentType string) (string, error) {
+	uploader.parts = map[int64][]byte{}
+	return "upload-id", nil
+}
+
+func (uploader *memoryUploader) PresignUploadPart(key, uploadID string, partNumber int64, ttl time.Duration) (string, error) {
+	return fmt.Sprintf("memory:%s?partNumber=%d", key, partNumber), nil
+}
+
+func (uploader *memoryUploader) uploadPart(partNumber int64, data []byte) *UploadedPart {
+	uploader.parts[partNumber] = data
+	return &UploadedPart{PartNumber: partNumber, ETag: md5Hex(data)}
+}
+
+func (uploader *memoryUploader) ListParts(key, uploadID string) (map[int64]string, error) {
+	etags := map[int64]string{}
+	for partNumber, data := range uploader.parts {
+		etags[partNumber] = md5Hex(data)
+	}
+	return etags, nil
+}
+
+func (uploader *memoryUploader) CompleteMultipartUpload(key, uploadID string, parts []*blob.Part) error {
+	var data []byte
+	for _, part := range parts {
+		data = append(data, uploader.parts[part.PartNumber]...)
+	}
+	return uploader.Put(key, bytes.NewReader(data), "")
+}
+
+func (uploader *memoryUploader) AbortMultipartUpload(key, uploadID string) error {
+	return nil
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type fakeStorageBucketRepository struct {
+	repository.StorageBucketRepository
+	bucket *model.StorageBucket
+}
+
+func (repo *fakeStorageBucketRepository) FindByName(name string) *model.StorageBucket {
+	if repo.bucket.Name == name {
+		return repo.bucket
+	}
+	return nil
+}
+
+type fakeStorageObjectRepository struct {
+	repository.StorageObjectRepository
+	objects map[string]*model.StorageObject
+}
+
+func (repo *fakeStorageObjectRepository) Find(bucketID int64, key string) *model.StorageObject {
+	return repo.objects[key]
+}
+
+func (repo *fakeStorageObjectRepository) Save(object *model.StorageObject) {
+	repo.objects[object.Key] = object
+}
+
+func (repo *fakeStorageObjectRepository) DeleteByKeys(bucketID int64, keys []string) {
+	for _, key := range keys {
+		delete(repo.objects, key)
+	}
+}
+
+type fakeStorageUploadRepository struct {
+	repository.StorageUploadRepository
+	uploads map[string]*model.StorageUpload
+}
+
+func (repo *fakeStorageUploadRepository) FindByUUID(uuid string) *model.StorageUpload {
+	return repo.uploads[uuid]
+}
+
+func (repo *fakeStorageUploadRepository) Save(upload *model.StorageUpload) {
+	now := time.Now()
+	upload.CreatedAt = &now
+	repo.uploads[upload.UUID] = upload
+}
+
+func (repo *fakeStorageUploadRepository) Delete(upload *model.StorageUpload) {
+	delete(repo.uploads, upload.UUID)
+}
+
+var uploadOwner = &model.UserIdentity{ModelMixin: model.ModelMixin{ID: 1}, Status: model.IdentityStatusActive}
+
+func newUploadService() (*StorageServiceImpl, *memoryUploader) {
+	bucket := &model.StorageBucket{
+		ModelMixin:    model.ModelMixin{ID: 2},
+		OwnerID:       uploadOwner.ID,
+		Owner:         *uploadOwner,
+		Name:          "files",
+		StoragePrefix: "prefix",
+	}
+	uploader := &memoryUploader{MemoryBackend: blob.NewMemoryBackend()}
+	return &StorageServiceImpl{
+		bucketRepo:    &fakeStorageBucketRepository{bucket: bucket},
+		objectRepo:    &fakeStorageObjectRepository{objects: map[string]*model.StorageObject{}},
+		uploadRepo:    &fakeStorageUploadRepository{uploads: map[string]*model.StorageUpload{}},
+		backend:       uploader,
+		maxObjectSize: testMaxObjectSize,
+	}, uploader
+}
+
+func TestCompleteUpload(t *testing.T) {
+	svc, uploader := newUploadService()
+
+	data := []byte("hello, world")
+	session, err := svc.CreateUpload(uploadOwner, "files", "hello.txt", "", int64(len(data)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = uploader.Put(strings.TrimPrefix(session.URL, "memory:"), bytes.NewReader(data), session.Upload.ContentType)
+
+	if _, err := svc.CompleteUpload(uploadOwner, "files", "hello.txt", session.Upload.UUID, nil); err != nil {
+		t.Fatal(err)
+	}
+	file, err := svc.ReadFile(uploadOwner, "files", "hello.txt")
+	if err != nil || file == nil {
+		t.Fatalf("expected the file, got %v", err)
+	}
+	if file.Size != int64(len(data)) || file.ContentType != "text/plain; charset=utf-8" || file.ETag != md5Hex(data) {
+		t.Errorf("unexpected metadata %+v", file)
+	}
+	if svc.uploadRepo.FindByUUID(session.Upload.UUID) != nil {
+		t.Error("expected the upload to be deleted")
+	}
+}
+
+func TestCreateUpload_MaxObjectSize(t *testing.T) {
+	svc, _ := newUploadService()
+
+	for _, parts := range []int{0, 2} {
+		_, err := svc.CreateUpload(uploadOwner, "files", "large.bin", "", testMaxObjectSize+1, parts)
+		if !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("parts %d: expected the size to be rejected, got %v", parts, err)
+		}
+	}
+}
+
+func TestCompleteUpload_DeletesRejectedFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		upload func(svc *StorageServiceImpl, uploader *memoryUploader) (*UploadSession, []*UploadedPart)
+	}{
+		{"larger than the maximum", func(svc *StorageServiceImpl, uploader *memoryUploader) (*UploadSession, []*UploadedPart) {
+			session, _ := svc.CreateUpload(uploadOwner, "files", "data.bin", "", 0, 2)
+			return session, []*UploadedPart{
+				uploader.uploadPart(1, bytes.Repeat([]byte("a"), testMaxObjectSize)),
+				uploader.uploadPart(2, []byte("b")),
+			}
+		}},
+		{"larger than the upload", func(svc *StorageServiceImpl, uploader *memoryUploader) (*UploadSession, []*UploadedPart) {
+			session, _ := svc.CreateUpload(uploadOwner, "files", "data.bin", "", 4, 0)
+			_ = uploader.Put("prefix/data.bin", strings.NewReader("more than 4"), "")
+			return session, nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, uploader := newUploadService()
+			session, parts := tt.upload(svc, uploader)
+
+			_, err := svc.CompleteUpload(uploadOwner, "files", "data.bin", session.Upload.UUID, parts)
+			if !errors.Is(err, ErrInvalidArgument) {
+				t.Fatalf("expected the file to be rejected, got %v", err)
+			}
+			if exists, _ := uploader.Head("prefix/data.bin"); exists {
+				t.Error("expected the file to be deleted")
+			}
+			if svc.objectRepo.Find(2, "data.bin") != nil || svc.uploadRepo.FindByUUID(session.Upload.UUID) != nil {
+				t.Error("expected the metadata and the upload to be deleted")
+			}
+		})
+	}
+}
+
+func TestCompleteUpload_ExistingFile(t *testing.T) {
+	svc, uploader := newUploadService()
+	if _, err := svc.WriteFile(uploadOwner, "files", "data.bin", "", strings.NewReader("old")); err != nil {
+		t.Fatal(err)
+	}
+	// S3 tracks modified times by seconds, so the upload is created in the next second of the existing file.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	for _, size := range []int64{3, 5} {
+		session, err := svc.CreateUpload(uploadOwner, "files", "data.bin", "", size, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The existing file is neither recorded nor deleted as the file of the upload.
+		_, err = svc.CompleteUpload(uploadOwner, "files", "data.bin", session.Upload.UUID, nil)
+		if !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("size %d: expected the file not to be uploaded yet, got %v", size, err)
+		}
+		if exists, _ := uploader.Head("prefix/data.bin"); !exists {
+			t.Fatalf("size %d: expected the existing file to be kept", size)
+		}
+		if object := svc.objectRepo.Find(2, "data.bin"); object == nil || object.ETag != md5Hex([]byte("old")) {
+			t.Fatalf("size %d: expected the metadata of the existing file to be kept, got %+v", size, object)
+		}
+		if svc.uploadRepo.FindByUUID(session.Upload.UUID) == nil {
+			t.Fatalf("size %d: expected the upload to be kept", size)
+		}
+	}
+
+	session, _ := svc.CreateUpload(uploadOwner, "files", "data.bin", "", 3, 0)
+	_ = uploader.Put("prefix/data.bin", strings.NewReader("new"), "")
+	object, err := svc.CompleteUpload(uploadOwner, "files", "data.bin", session.Upload.UUID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.ETag != md5Hex([]byte("new")) {
+		t.Errorf("expected the new file to be recorded, got %+v", object)
+	}
+}
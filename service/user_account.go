@@ -13,20 +13,27 @@ import (
 
 const (
 	providerGoogle = "google"
+	providerEmail  = "email"
 )
 
 type UserAccountService interface {
 	FindOrCreateByGoogleAccount(string) (*model.UserAccount, error)
+	LinkGoogleAccount(identity *model.UserIdentity, idToken string) (*model.UserAccount, error)
 }
 
 type UserAccountServiceImpl struct {
 	accountRepo  repository.UserAccountRepository
 	identityRepo repository.UserIdentityRepository
+	webhookSvc   WebhookService
 	validator    *idtoken.Validator
 	audience     string
 }
 
-func NewUserAccountService(accountRepo repository.UserAccountRepository, identityRepo repository.UserIdentityRepository) (UserAccountService, error) {
+func NewUserAccountService(
+	accountRepo repository.UserAccountRepository,
+	identityRepo repository.UserIdentityRepository,
+	webhookSvc WebhookService,
+) (UserAccountService, error) {
 	googleClientID := os.Getenv("GOOGLE_CLIENT_ID")
 	googleCredPath := os.Getenv("GOOGLE_SECRET_ACCOUNT_PATH")
 
@@ -35,7 +42,7 @@ func NewUserAccountService(accountRepo repository.UserAccountRepository, identit
 		return nil, err
 	}
 
-	return &UserAccountServiceImpl{accountRepo, identityRepo, validator, googleClientID}, nil
+	return &UserAccountServiceImpl{accountRepo, identityRepo, webhookSvc, validator, googleClientID}, nil
 }
 
 func (svc *UserAccountServiceImpl) FindOrCreateByGoogleAccount(idToken string) (*model.UserAccount, error) {
@@ -51,12 +58,44 @@ func (svc *UserAccountServiceImpl) FindOrCreateByGoogleAccount(idToken string) (
 		token, _ := jwt.Parse(idToken, nil)
 		claims := token.Claims.(jwt.MapClaims)
 
-		identity := &model.UserIdentity{UUID: uuid.New().String(), Username: claims["name"].(string), Email: claims["email"].(string)}
+		identity := &model.UserIdentity{
+			UUID:     uuid.New().String(),
+			Username: claims["name"].(string),
+			Email:    claims["email"].(string),
+			Status:   model.IdentityStatusActive,
+		}
 		svc.identityRepo.Save(identity)
 
 		account = &model.UserAccount{Provider: providerGoogle, ProviderID: payload.Subject, IdentityID: identity.ID, Identity: *identity}
 		svc.accountRepo.Save(account)
 	}
 
+	if err := checkIdentityStatus(&account.Identity); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// LinkGoogleAccount links a Google account to the identity. A guest identity is upgraded to a full identity in place,
+// so that everything created as a guest is kept.
+func (svc *UserAccountServiceImpl) LinkGoogleAccount(identity *model.UserIdentity, idToken string) (*model.UserAccount, error) {
+	payload, err := svc.validator.Validate(context.Background(), idToken, svc.audience)
+	if err != nil {
+		return nil, err
+	}
+
+	if account := svc.accountRepo.FindByProviderId(providerGoogle, payload.Subject); account != nil {
+		if account.IdentityID != identity.ID {
+			return nil, ErrAccountAlreadyLinked
+		}
+		return account, nil
+	}
+
+	token, _ := jwt.Parse(idToken, nil)
+	claims := token.Claims.(jwt.MapClaims)
+	upgradeGuest(svc.identityRepo, svc.webhookSvc, identity, claims["name"].(string), claims["email"].(string))
+
+	account := &model.UserAccount{Provider: providerGoogle, ProviderID: payload.Subject, IdentityID: identity.ID, Identity: *identity}
+	svc.accountRepo.Save(account)
 	return account, nil
 }
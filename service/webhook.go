@@ -0,0 +1,349 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hellodhlyn/luppiter/model"
+	"github.com/hellodhlyn/luppiter/repository"
+)
+
+const (
+	webhookBatchSize      = 20
+	webhookLease          = 5 * time.Minute
+	webhookTimeout        = 10 * time.Second
+	webhookMaxAttempts    = 8
+	webhookInitialBackoff = time.Minute
+	webhookMaxBackoff     = 6 * time.Hour
+)
+
+// Headers of webhook requests.
+const (
+	WebhookHeaderEvent     = "Luppiter-Event"
+	WebhookHeaderDelivery  = "Luppiter-Delivery"
+	WebhookHeaderSignature = "Luppiter-Signature"
+)
+
+// WebhookService notifies applications of events of their users, through webhooks registered by the applications.
+// Deliveries are queued in the database, and retried with exponential backoff until the endpoint accepts them.
+type WebhookService interface {
+	ListWebhooks(identity *model.UserIdentity, app *model.Application) ([]*model.Webhook, error)
+	CreateWebhook(identity *model.UserIdentity, app *model.Application, endpoint string, events []string) (*model.Webhook, error)
+	UpdateWebhook(identity *model.UserIdentity, app *model.Application, webhookUUID, endpoint string, events []string, active bool) (*model.Webhook, error)
+	DeleteWebhook(identity *model.UserIdentity, app *model.Application, webhookUUID string) error
+	ListDeliveries(identity *model.UserIdentity, app *model.Application, webhookUUID string, offset, limit int) ([]*model.WebhookDelivery, error)
+	Redeliver(identity *model.UserIdentity, app *model.Application, webhookUUID, deliveryUUID string) (*model.WebhookDelivery, error)
+
+	NotifyApplication(event string, identity *model.UserIdentity, app *model.Application)
+	NotifyAuthorizedApps(event string, identity *model.UserIdentity)
+	ProcessQueue() int
+	RunQueue(interval time.Duration)
+}
+
+type WebhookServiceImpl struct {
+	repo         repository.WebhookRepository
+	deliveryRepo repository.WebhookDeliveryRepository
+	consentRepo  repository.ConsentGrantRepository
+	orgRepo      repository.OrganizationRepository
+	client       *http.Client
+}
+
+func NewWebhookService(
+	repo repository.WebhookRepository,
+	deliveryRepo repository.WebhookDeliveryRepository,
+	consentRepo repository.ConsentGrantRepository,
+	orgRepo repository.OrganizationRepository,
+) (WebhookService, error) {
+	return &WebhookServiceImpl{repo, deliveryRepo, consentRepo, orgRepo, newWebhookClient()}, nil
+}
+
+// WebhookPayload is the body of webhook requests.
+type WebhookPayload struct {
+	ID          string             `json:"id"`
+	Type        string             `json:"type"`
+	Application string             `json:"application"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	Data        WebhookPayloadData `json:"data"`
+}
+
+type WebhookPayloadData struct {
+	Identity string `json:"identity"`
+	Email    string `json:"email,omitempty"`
+}
+
+func (svc *WebhookServiceImpl) ListWebhooks(identity *model.UserIdentity, app *model.Application) ([]*model.Webhook, error) {
+	if !svc.hasPermission(identity, app) {
+		return nil, ErrPermissionDenied
+	}
+	return svc.repo.FindByApplicationID(app.ID), nil
+}
+
+// CreateWebhook registers an endpoint with a new signing secret, which is shown to the user only once.
+func (svc *WebhookServiceImpl) CreateWebhook(identity *model.UserIdentity, app *model.Application, endpoint string, events []string) (*model.Webhook, error) {
+	if !svc.hasPermission(identity, app) {
+		return nil, ErrPermissionDenied
+	}
+	if err := validateWebhook(endpoint, events); err != nil {
+		return nil, err
+	}
+
+	webhook := &model.Webhook{
+		UUID:          uuid.New().String(),
+		ApplicationID: app.ID,
+		URL:           endpoint,
+		Events:        events,
+		SigningSecret: "whsec_" + secureRandomString(24),
+		Active:        true,
+	}
+	if err := svc.repo.Save(webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (svc *WebhookServiceImpl) UpdateWebhook(identity *model.UserIdentity, app *model.Application, webhookUUID, endpoint string, events []string, active bool) (*model.Webhook, error) {
+	webhook, err := svc.findWebhook(identity, app, webhookUUID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWebhook(endpoint, events); err != nil {
+		return nil, err
+	}
+
+	webhook.URL = endpoint
+	webhook.Events = events
+	webhook.Active = active
+	if err := svc.repo.Save(webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (svc *WebhookServiceImpl) DeleteWebhook(identity *model.UserIdentity, app *model.Application, webhookUUID string) error {
+	webhook, err := svc.findWebhook(identity, app, webhookUUID)
+	if err != nil {
+		return err
+	}
+	svc.repo.Delete(webhook)
+	return nil
+}
+
+func (svc *WebhookServiceImpl) ListDeliveries(identity *model.UserIdentity, app *model.Application, webhookUUID string, offset, limit int) ([]*model.WebhookDelivery, error) {
+	webhook, err := svc.findWebhook(identity, app, webhookUUID)
+	if err != nil {
+		return nil, err
+	}
+	return svc.deliveryRepo.FindByWebhookID(webhook.ID, offset, limit), nil
+}
+
+// Redeliver queues the event of a delivery again as a new delivery. The event ID is kept, so that receivers can tell
+// duplicated events.
+func (svc *WebhookServiceImpl) Redeliver(identity *model.UserIdentity, app *model.Application, webhookUUID, deliveryUUID string) (*model.WebhookDelivery, error) {
+	webhook, err := svc.findWebhook(identity, app, webhookUUID)
+	if err != nil {
+		return nil, err
+	}
+	delivery := svc.deliveryRepo.FindByUUID(deliveryUUID)
+	if delivery == nil || delivery.WebhookID != webhook.ID {
+		return nil, fmt.Errorf("%w: no such delivery", ErrNotFound)
+	}
+	return svc.enqueue(webhook, delivery.EventID, delivery.Event, delivery.Payload), nil
+}
+
+// NotifyApplication queues the event to webhooks of the application.
+func (svc *WebhookServiceImpl) NotifyApplication(event string, identity *model.UserIdentity, app *model.Application) {
+	svc.notify(event, app, WebhookPayloadData{Identity: identity.UUID})
+}
+
+// NotifyAuthorizedApps queues the event to webhooks of every application which the identity granted access to. Email
+// addresses are only sent to applications granted the email scope.
+func (svc *WebhookServiceImpl) NotifyAuthorizedApps(event string, identity *model.UserIdentity) {
+	for _, grant := range svc.consentRepo.FindByIdentityID(identity.ID) {
+		data := WebhookPayloadData{Identity: identity.UUID}
+		if event == model.WebhookEventIdentityEmailChanged && grant.Covers([]string{model.ScopeEmail}) {
+			data.Email = identity.Email
+		}
+		svc.notify(event, &grant.Application, data)
+	}
+}
+
+// ProcessQueue sends a batch of due deliveries, and returns the number of deliveries accepted by endpoints.
+func (svc *WebhookServiceImpl) ProcessQueue() int {
+	delivered := 0
+	for _, delivery := range svc.deliveryRepo.ClaimDue(webhookBatchSize, webhookLease) {
+		webhook := svc.repo.FindByID(delivery.WebhookID)
+		if webhook == nil {
+			delivery.Status = model.WebhookDeliveryStatusFailed
+			delivery.LastError = "the webhook is deleted"
+			svc.deliveryRepo.Save(delivery)
+			continue
+		}
+
+		delivery.Attempts++
+		status, err := svc.send(webhook, delivery)
+		delivery.ResponseStatus = status
+
+		now := time.Now()
+		if err == nil {
+			delivery.Status = model.WebhookDeliveryStatusDelivered
+			delivery.DeliveredAt = &now
+			delivery.LastError = ""
+			delivered++
+		} else if delivery.Attempts >= webhookMaxAttempts {
+			delivery.Status = model.WebhookDeliveryStatusFailed
+			delivery.LastError = err.Error()
+		} else {
+			next := now.Add(backoff(delivery.Attempts, webhookInitialBackoff, webhookMaxBackoff))
+			delivery.NextAttemptAt = &next
+			delivery.LastError = err.Error()
+		}
+		svc.deliveryRepo.Save(delivery)
+	}
+	return delivered
+}
+
+func (svc *WebhookServiceImpl) RunQueue(interval time.Duration) {
+	for range time.Tick(interval) {
+		if delivered := svc.ProcessQueue(); delivered > 0 {
+			log.Printf("delivered %d webhook events", delivered)
+		}
+	}
+}
+
+func (svc *WebhookServiceImpl) notify(event string, app *model.Application, data WebhookPayloadData) {
+	var webhooks []*model.Webhook
+	for _, webhook := range svc.repo.FindByApplicationID(app.ID) {
+		if webhook.Active && webhook.Subscribes(event) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload := &WebhookPayload{
+		ID:          uuid.New().String(),
+		Type:        event,
+		Application: app.UUID,
+		CreatedAt:   time.Now(),
+		Data:        data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("failed to encode the webhook payload: %v", err)
+		return
+	}
+	for _, webhook := range webhooks {
+		svc.enqueue(webhook, payload.ID, event, string(body))
+	}
+}
+
+func (svc *WebhookServiceImpl) enqueue(webhook *model.Webhook, eventID, event, payload string) *model.WebhookDelivery {
+	now := time.Now()
+	delivery := &model.WebhookDelivery{
+		UUID:          uuid.New().String(),
+		WebhookID:     webhook.ID,
+		EventID:       eventID,
+		Event:         event,
+		Payload:       payload,
+		Status:        model.WebhookDeliveryStatusPending,
+		NextAttemptAt: &now,
+	}
+	svc.deliveryRepo.Save(delivery)
+	return delivery
+}
+
+func (svc *WebhookServiceImpl) send(webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	if req.URL.Scheme != "https" {
+		return 0, errors.New("webhook url should be https")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Luppiter-Webhook")
+	req.Header.Set(WebhookHeaderEvent, delivery.Event)
+	req.Header.Set(WebhookHeaderDelivery, delivery.UUID)
+	req.Header.Set(WebhookHeaderSignature, SignWebhookPayload(webhook.SigningSecret, time.Now(), delivery.Payload))
+
+	res, err := svc.client.Do(req)
+	if err != nil {
+		log.Printf("failed to deliver %s to webhook %s: %v", delivery.UUID, webhook.UUID, err)
+		return 0, webhookRequestError(err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// webhookRequestError hides details of connection errors, such as refused ports, since the delivery log is shown to
+// applications.
+func webhookRequestError(err error) error {
+	if errors.Is(err, ErrWebhookAddressNotAllowed) {
+		return ErrWebhookAddressNotAllowed
+	}
+	if uerr, ok := err.(*url.Error); ok && uerr.Timeout() {
+		return errors.New("request timed out")
+	}
+	return errors.New("failed to connect to the webhook")
+}
+
+func (svc *WebhookServiceImpl) findWebhook(identity *model.UserIdentity, app *model.Application, webhookUUID string) (*model.Webhook, error) {
+	if !svc.hasPermission(identity, app) {
+		return nil, ErrPermissionDenied
+	}
+	webhook := svc.repo.FindByUUID(webhookUUID)
+	if webhook == nil || webhook.ApplicationID != app.ID {
+		return nil, fmt.Errorf("%w: no such webhook", ErrNotFound)
+	}
+	return webhook, nil
+}
+
+func (svc *WebhookServiceImpl) hasPermission(identity *model.UserIdentity, app *model.Application) bool {
+	return isPermitted(svc.orgRepo, identity, int64(app.OwnerID), app.OrganizationID, PermissionManage)
+}
+
+// SignWebhookPayload returns the signature header of the payload, in the form of `t=<unix time>,v1=<hex>`. The
+// signature is HMAC-SHA256 of `<unix time>.<payload>` by the signing secret, so that receivers can reject replays.
+func SignWebhookPayload(signingSecret string, t time.Time, payload string) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhook checks that the endpoint is an https URL of a public host. The addresses are checked again on every
+// delivery, since they may change after the registration.
+func validateWebhook(endpoint string, events []string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return invalidArgument("webhook url should be an absolute https url")
+	}
+	if err := resolvePublicHost(u.Hostname()); err != nil {
+		return invalidArgument(err.Error())
+	}
+	if len(events) == 0 {
+		return invalidArgument("at least one event is required")
+	}
+	for _, event := range events {
+		if !model.IsValidWebhookEvent(event) {
+			return invalidArgument("unknown event " + event)
+		}
+	}
+	return nil
+}